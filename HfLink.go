@@ -2,24 +2,87 @@ package httpfsclient
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"path"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
 // HfLink := clusterId:serverId/relativePath
 type HfLink string
 
+// HfLinkScheme prefixes the uri form of a link, eg. hf://static:s1/txt/a.go
+const HfLinkScheme = "hf://"
+
+type HfLinkError struct {
+	Link   string
+	Reason string
+}
+
+func (e *HfLinkError) Error() string {
+	return "invalid hflink " + strconv.Quote(e.Link) + ": " + e.Reason
+}
+
 func IsHfLink(url string) bool {
-	i := strings.Index(url, "/")
+	_, err := ParseHfLink(url)
+	return err == nil
+}
+
+// ParseHfLink parses and normalises a link.
+//
+//	hflink = [ "hf://" ] id ":" id path
+//	id     = 1*( ALPHA / DIGIT / "-" / "_" / "." )
+//	path   = 1*( "/" segment ) ; no "..", "?", "#", "\" or control chars
+//
+// Empty and "." segments are removed, so hf://static:s1//txt/./a.go -> static:s1/txt/a.go
+func ParseHfLink(s string) (HfLink, error) {
+	ds := strings.TrimPrefix(s, HfLinkScheme)
+	i := strings.Index(ds, "/")
 	if i == -1 {
+		return "", &HfLinkError{s, "missing path"}
+	}
+	j := strings.Index(ds[:i], ":")
+	if j == -1 {
+		return "", &HfLinkError{s, "missing clusterId:serverId"}
+	}
+	clusterId, serverId, p := ds[:j], ds[j+1:i], ds[i:]
+	if !validHfId(clusterId) {
+		return "", &HfLinkError{s, "bad cluster id"}
+	}
+	if !validHfId(serverId) {
+		return "", &HfLinkError{s, "bad server id"}
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if ".." == seg {
+			return "", &HfLinkError{s, "path contains .."}
+		}
+	}
+	for _, c := range p {
+		if c < 0x20 || c == 0x7f || c == '?' || c == '#' || c == '\\' {
+			return "", &HfLinkError{s, "bad path char " + strconv.QuoteRune(c)}
+		}
+	}
+	p = path.Clean(p)
+	if "/" == p {
+		return "", &HfLinkError{s, "empty path"}
+	}
+	return HfLink(clusterId + ":" + serverId + p), nil
+}
+
+func validHfId(id string) bool {
+	if "" == id {
 		return false
 	}
-	head := url[0:i]
-	return strings.Index(head, ":") != -1
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
 }
 
 func NewHfLink(clusterId, serverId, filepath string) HfLink {
@@ -37,30 +100,98 @@ func urlPathStartIndex(url string) int {
 	return i + 3 + pi
 }
 
-// http://xxx/image/1.jpg -> s:1/image/1.jpg
+// http://xxx/image/1.jpg -> s:1/image/1.jpg , hf://s:1/image/1.jpg -> s:1/image/1.jpg
+// Any url made by Url() can be inverted, query and fragment are ignored.
 func FromUrl(url string) (HfLink, bool) {
-	pi := strings.Index(url, "://")
-	i := strings.Index(url[pi+3:], "/") + 3 + pi
-	proxy := url[0:i]
-	clusterId, serverId := GetClusters().HfsId(proxy)
-	if clusterId == "" || serverId == "" {
-		return HfLink(url), false
+	if strings.HasPrefix(url, HfLinkScheme) {
+		d, err := ParseHfLink(url)
+		return d, err == nil
 	}
-
-	return NewHfLink(clusterId, serverId, url[i:]), true
+	if d, ok := fromBuiltUrl(url); ok {
+		return d, true
+	}
+	return HfLink(url), false
 }
 
 // eg. s:1/txt/00/00/yyfoatapk5/bdu9kjosiq.go -> http://xxx/txt/00/00/yyfoatapk5/bdu9kjosiq.go
+// The url is made by the UrlBuilder of the link's cluster and collection, see SetUrlBuilder.
 func (d HfLink) Url() string {
+	d = d.Resolve()
 	clusterId, serverId, path := d.Parts()
-	return GetClusters().GetServer(clusterId, serverId).Proxy + path
+	server := GetServer(clusterId, serverId)
+	if "" == server.ClusterId {
+		return path
+	}
+	return GetUrlBuilder(clusterId, d.Collection()).BuildUrl(server, path)
 }
 func (d HfLink) String() string {
 	return string(d)
 }
 
+// Uri returns the uri form, eg. hf://static:s1/txt/a.go
+func (d HfLink) Uri() string {
+	return HfLinkScheme + strings.TrimPrefix(string(d), HfLinkScheme)
+}
+
+// canonicalHfLink converts a link or an url of a known server to the link form, "" is kept.
+// Any other value is an HfLinkError, it is never stored.
+func canonicalHfLink(s string) (HfLink, error) {
+	if "" == s {
+		return "", nil
+	}
+	return parseHfLinkOrUrl(s)
+}
+
+// parseHfLinkOrUrl accepts a link, its uri form or an url of a known server.
+func parseHfLinkOrUrl(s string) (HfLink, error) {
+	d, err := ParseHfLink(s)
+	if err == nil {
+		return d, nil
+	}
+	if strings.Contains(s, "://") {
+		if d, ok := FromUrl(s); ok {
+			return d, nil
+		}
+		return "", &HfLinkError{s, "unknown url"}
+	}
+	return "", err
+}
+
+// Scan implements sql.Scanner. NULL scans to an empty link.
+func (d *HfLink) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		return d.scanString(v)
+	case []byte:
+		return d.scanString(string(v))
+	case nil:
+		*d = ""
+	default:
+		return fmt.Errorf("sql: cannot scan %T into HfLink", value)
+	}
+	return nil
+}
+
+func (d *HfLink) scanString(s string) error {
+	link, err := canonicalHfLink(s)
+	if err != nil {
+		return err
+	}
+	*d = link
+	return nil
+}
+
+// Value implements driver.Valuer, the link form is stored.
+func (d HfLink) Value() (driver.Value, error) {
+	link, err := canonicalHfLink(string(d))
+	if err != nil {
+		return nil, err
+	}
+	return string(link), nil
+}
+
 func (d HfLink) Stat() (FileInfo, error) {
-	clusterId, serverId, path := d.Parts()
+	clusterId, serverId, path := d.Resolve().Parts()
 	server := GetServer(clusterId, serverId)
 	if "" == server.ClusterId {
 		return FileInfo{}, errors.New("no such server:" + string(d))
@@ -68,7 +199,7 @@ func (d HfLink) Stat() (FileInfo, error) {
 	return (&Client{Server: server.Local}).Stat(path)
 }
 func (d HfLink) Read() ([]byte, error) {
-	clusterId, serverId, path := d.Parts()
+	clusterId, serverId, path := d.Resolve().Parts()
 	server := GetServer(clusterId, serverId)
 	if "" == server.ClusterId {
 		return nil, errors.New("no such server:" + string(d))
@@ -76,25 +207,28 @@ func (d HfLink) Read() ([]byte, error) {
 	return (&Client{Server: server.Local}).Read(path)
 }
 func (d HfLink) Call(module, method string, args, result interface{}) error {
-	clusterId, serverId, _ := d.Parts()
+	clusterId, serverId, _ := d.Resolve().Parts()
 	return Methods{}.Call(clusterId, serverId, module, method, args, result)
 }
-func (d HfLink) CallAsync(module, method string, args interface{}) error {
-	clusterId, serverId, _ := d.Parts()
+func (d HfLink) CallAsync(module, method string, args interface{}) (*Job, error) {
+	clusterId, serverId, _ := d.Resolve().Parts()
 	return Methods{}.CallAsync(clusterId, serverId, module, method, args)
 }
 func (d HfLink) ImageResize(crop []int, sizes [][]int) ([]HfLink, error) {
 	return Methods{}.ImageCropResize(d, crop, sizes)
 }
-func (d HfLink) VideoCompressDash(videoId int, redisProgressKey string) error {
+func (d HfLink) ImageCropResizeParam(param ImageTransformParam) ([]HfLink, error) {
+	return Methods{}.ImageCropResizeParam(d, param)
+}
+func (d HfLink) VideoCompressDash(videoId int, redisProgressKey string) (*Job, error) {
 	return Methods{}.VideoCompressDash(d, videoId, redisProgressKey)
 }
-func (d HfLink) Mp4(videoId int, redisProgressKey string) error {
+func (d HfLink) Mp4(videoId int, redisProgressKey string) (*Job, error) {
 	return Methods{}.Mp4(d, videoId, redisProgressKey)
 }
 
 func (d HfLink) Path() string {
-	ds := string(d)
+	ds := strings.TrimPrefix(string(d), HfLinkScheme)
 	i := strings.Index(ds, "/")
 	if i == -1 || '/' == ds[0] {
 		return ds
@@ -102,7 +236,7 @@ func (d HfLink) Path() string {
 	return ds[i:]
 }
 func (d HfLink) Parts() (string, string, string) {
-	ds := string(d)
+	ds := strings.TrimPrefix(string(d), HfLinkScheme)
 	i := strings.Index(ds, "/")
 	if i == -1 || '/' == ds[0] {
 		return "", "", ds
@@ -130,7 +264,7 @@ func FromHfLink(s HfLink) NullHfLink {
 	return NullHfLink{
 		NullString: sql.NullString{
 			String: string(s),
-			Valid:  len(s) == 0,
+			Valid:  len(s) != 0,
 		},
 	}
 }
@@ -143,12 +277,13 @@ func (s *NullHfLink) UnmarshalJSON(data []byte) error {
 	}
 	switch x := v.(type) {
 	case string:
-		if IsHfLink(x) {
-			s.String = x
-		} else {
-			dd, _ := FromUrl(x)
-			s.String = string(dd)
+		if "" == x {
+			s.String, s.Valid = "", false
+			return nil
 		}
+		var d HfLink
+		d, err = parseHfLinkOrUrl(x)
+		s.String = string(d)
 	case map[string]interface{}:
 		err = json.Unmarshal(data, &s.NullString)
 	case nil:
@@ -190,11 +325,37 @@ func (s NullHfLink) MarshalText() ([]byte, error) {
 // UnmarshalText implements encoding.TextUnmarshaler.
 // It will unmarshal to a null String if the input is a blank string.
 func (s *NullHfLink) UnmarshalText(text []byte) error {
-	s.String = HfLink(string(text)).Url()
+	link, err := canonicalHfLink(string(text))
+	if err != nil {
+		return err
+	}
+	s.String = string(link)
 	s.Valid = s.String != ""
 	return nil
 }
 
+// Scan implements sql.Scanner. It will scan to a null String if the value is NULL or empty.
+func (s *NullHfLink) Scan(value interface{}) error {
+	if value == nil {
+		s.String, s.Valid = "", false
+		return nil
+	}
+	var d HfLink
+	if err := d.Scan(value); err != nil {
+		return err
+	}
+	s.String, s.Valid = string(d), d != ""
+	return nil
+}
+
+// Value implements driver.Valuer. It stores NULL if this String is null, else the link form.
+func (s NullHfLink) Value() (driver.Value, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	return HfLink(s.String).Value()
+}
+
 // SetValid changes this String's value and also sets it to be non-null.
 func (s *NullHfLink) SetValid(v string) {
 	s.String = v
@@ -0,0 +1,175 @@
+package httpfsclient_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ sql.Scanner   = (*httpfsclient.HfLink)(nil)
+	_ driver.Valuer = httpfsclient.HfLink("")
+	_ sql.Scanner   = (*httpfsclient.NullHfLink)(nil)
+	_ driver.Valuer = httpfsclient.NullHfLink{}
+)
+
+const testLink = httpfsclient.HfLink("linkc:s1/txt/00/00/yyfoatapk5/bdu9kjosiq.go")
+const testUrl = "http://link.test/txt/00/00/yyfoatapk5/bdu9kjosiq.go"
+
+func init() {
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "linkc", ServerId: "s1", Proxy: "http://link.test"})
+}
+
+func TestHfLinkSql(t *testing.T) {
+	var d httpfsclient.HfLink
+	assert.Nil(t, d.Scan(string(testLink)))
+	assert.Equal(t, testLink, d)
+	assert.Nil(t, d.Scan([]byte(testUrl)))
+	assert.Equal(t, testLink, d)
+	assert.Nil(t, d.Scan(nil))
+	assert.Equal(t, httpfsclient.HfLink(""), d)
+	assert.NotNil(t, d.Scan(1))
+
+	v, err := testLink.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, string(testLink), v)
+	v, _ = httpfsclient.HfLink(testUrl).Value()
+	assert.Equal(t, string(testLink), v)
+
+	d = testLink
+	assert.NotNil(t, d.Scan("http://unknown.test/txt/a.go"))
+	assert.Equal(t, testLink, d)
+	_, err = httpfsclient.HfLink("http://unknown.test/txt/a.go").Value()
+	assert.NotNil(t, err)
+
+	// values that are no links are errors, "" is kept
+	err = d.Scan("abc")
+	assert.IsType(t, &httpfsclient.HfLinkError{}, err)
+	assert.Equal(t, testLink, d)
+	_, err = httpfsclient.HfLink("abc").Value()
+	assert.IsType(t, &httpfsclient.HfLinkError{}, err)
+	assert.Nil(t, d.Scan(""))
+	assert.Equal(t, httpfsclient.HfLink(""), d)
+	v, err = httpfsclient.HfLink("").Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "", v)
+}
+
+func TestNullHfLinkSql(t *testing.T) {
+	var n httpfsclient.NullHfLink
+	assert.Nil(t, n.Scan(nil))
+	assert.False(t, n.Valid)
+	v, err := n.Value()
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	assert.Nil(t, n.Scan([]byte(testLink)))
+	assert.True(t, n.Valid)
+	assert.Equal(t, testLink, n.HfLink())
+	assert.Nil(t, n.Scan(testUrl))
+	assert.Equal(t, testLink, n.HfLink())
+	v, _ = n.Value()
+	assert.Equal(t, string(testLink), v)
+	assert.NotNil(t, n.Scan(1.5))
+	assert.NotNil(t, n.Scan("abc"))
+	assert.Nil(t, n.Scan(""))
+	assert.False(t, n.Valid)
+	assert.Nil(t, n.Scan([]byte{}))
+	assert.False(t, n.Valid)
+
+	assert.True(t, httpfsclient.FromHfLink(testLink).Valid)
+	assert.False(t, httpfsclient.FromHfLink("").Valid)
+}
+
+func TestNullHfLinkJson(t *testing.T) {
+	type doc struct {
+		Link  httpfsclient.HfLink
+		Image httpfsclient.NullHfLink
+		Empty httpfsclient.NullHfLink
+	}
+	bs, err := json.Marshal(doc{Link: testLink, Image: httpfsclient.FromHfLink(testLink)})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"Link":"`+string(testLink)+`","Image":"`+testUrl+`","Empty":null}`, string(bs))
+
+	var d doc
+	assert.Nil(t, json.Unmarshal(bs, &d))
+	assert.Equal(t, testLink, d.Link)
+	assert.Equal(t, testLink, d.Image.HfLink())
+	assert.True(t, d.Image.Valid)
+	assert.False(t, d.Empty.Valid)
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"Image":"`+string(testLink)+`"}`), &d))
+	assert.Equal(t, testLink, d.Image.HfLink())
+}
+
+func TestNullHfLinkText(t *testing.T) {
+	bs, err := httpfsclient.FromHfLink(testLink).MarshalText()
+	assert.Nil(t, err)
+	assert.Equal(t, testUrl, string(bs))
+
+	var n httpfsclient.NullHfLink
+	assert.Nil(t, n.UnmarshalText(bs))
+	assert.True(t, n.Valid)
+	assert.Equal(t, testLink, n.HfLink())
+	assert.Nil(t, n.UnmarshalText([]byte(testLink)))
+	assert.Equal(t, testLink, n.HfLink())
+	assert.NotNil(t, n.UnmarshalText([]byte("http://unknown.test/txt/a.go")))
+
+	bs, _ = httpfsclient.NullHfLink{}.MarshalText()
+	assert.Equal(t, 0, len(bs))
+	assert.Nil(t, n.UnmarshalText(bs))
+	assert.False(t, n.Valid)
+}
+
+func TestParseHfLink(t *testing.T) {
+	ok := map[string]string{
+		"static:s1/txt/00/00/yyfoatapk5/bdu9kjosiq.go":      "static:s1/txt/00/00/yyfoatapk5/bdu9kjosiq.go",
+		"hf://static:s1/txt/00/00/yyfoatapk5/bdu9kjosiq.go": "static:s1/txt/00/00/yyfoatapk5/bdu9kjosiq.go",
+		"static:s1//txt/./00/a.go/":                         "static:s1/txt/00/a.go",
+		"my-cluster_2:srv.1/a":                              "my-cluster_2:srv.1/a",
+	}
+	for in, want := range ok {
+		d, err := httpfsclient.ParseHfLink(in)
+		assert.Nil(t, err, in)
+		assert.Equal(t, httpfsclient.HfLink(want), d, in)
+		assert.True(t, httpfsclient.IsHfLink(in), in)
+	}
+	bad := []string{"", "a:b", "http://x/y", "/txt/a.go", ":s1/a", "static:/a", "static:s1/", "static:s1/../a",
+		"static:s1/a/../../b", "sta tic:s1/a", "static:s:1/a", "static:s1/a?b", "static:s1/a#b", "static:s1/a\\b", "static:s1/a\x00"}
+	for _, in := range bad {
+		_, err := httpfsclient.ParseHfLink(in)
+		assert.NotNil(t, err, in)
+		assert.IsType(t, &httpfsclient.HfLinkError{}, err, in)
+		assert.False(t, httpfsclient.IsHfLink(in), in)
+	}
+
+	d := httpfsclient.HfLink("hf://static:s1/txt/a.go")
+	c, s, p := d.Parts()
+	assert.Equal(t, []string{"static", "s1", "/txt/a.go"}, []string{c, s, p})
+	assert.Equal(t, "/txt/a.go", d.Path())
+	assert.Equal(t, "hf://static:s1/txt/a.go", httpfsclient.HfLink("static:s1/txt/a.go").Uri())
+}
+
+func TestFromUrl(t *testing.T) {
+	d, ok := httpfsclient.FromUrl(testUrl)
+	assert.True(t, ok)
+	assert.Equal(t, testLink, d)
+	d, ok = httpfsclient.FromUrl(testLink.Uri())
+	assert.True(t, ok)
+	assert.Equal(t, testLink, d)
+	for _, u := range []string{"", "http://unknown.test/a.jpg", "http://link.test/../a.jpg", "http://link.test"} {
+		_, ok = httpfsclient.FromUrl(u)
+		assert.False(t, ok, u)
+	}
+
+	var n httpfsclient.NullHfLink
+	assert.NotNil(t, json.Unmarshal([]byte(`"http://unknown.test/a.jpg"`), &n))
+	assert.NotNil(t, json.Unmarshal([]byte(`"a:b"`), &n))
+	assert.False(t, n.Valid)
+	assert.Nil(t, json.Unmarshal([]byte(`""`), &n))
+	assert.False(t, n.Valid)
+}
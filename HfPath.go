@@ -0,0 +1,109 @@
+package httpfsclient
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/RocksonZeta/httpfsclient/util/hashutil"
+)
+
+var Collections = []string{CollectionImage, CollectionVideo, CollectionEpub, CollectionTxt, CollectionPdf, CollectionBin, CollectionOffice, CollectionZip}
+
+func IsCollection(collection string) bool {
+	for _, c := range Collections {
+		if c == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// HfPath is the layout of a stored path: /collection/shards.../objectId/name
+// eg. /txt/00/00/yyfoatapk5/bdu9kjosiq.go -> {txt [00 00] yyfoatapk5 bdu9kjosiq.go}
+type HfPath struct {
+	Collection string
+	Shards     []string
+	ObjectId   string
+	Name       string
+}
+
+func ParseHfPath(p string) (HfPath, error) {
+	for _, seg := range strings.Split(p, "/") {
+		if ".." == seg {
+			return HfPath{}, errors.New("bad hfpath, contains ..:" + p)
+		}
+	}
+	segs := strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/")
+	if len(segs) < 3 {
+		return HfPath{}, errors.New("bad hfpath, must be /collection/[shards/]objectId/name:" + p)
+	}
+	for _, seg := range segs {
+		if "" == seg {
+			return HfPath{}, errors.New("bad hfpath:" + p)
+		}
+	}
+	n := len(segs)
+	return HfPath{Collection: segs[0], Shards: segs[1 : n-2], ObjectId: segs[n-2], Name: segs[n-1]}, nil
+}
+
+// NewHfPath builds a path in the layout of the server. The server picks the shard dirs when it writes a file,
+// so the caller passes them, eg. the Shards of a path the server returned.
+func NewHfPath(collection string, shards []string, objectId, name string) HfPath {
+	return HfPath{Collection: collection, Shards: append([]string(nil), shards...), ObjectId: objectId, Name: name}
+}
+
+// RandomHfPath builds a path with a random objectId and file name, eg. /txt/00/00/yyfoatapk5/bdu9kjosiq.go
+func RandomHfPath(collection string, shards []string, ext string) HfPath {
+	if "" != ext && '.' != ext[0] {
+		ext = "." + ext
+	}
+	return NewHfPath(collection, shards, hashutil.RandomStr(10, true), hashutil.RandomStr(10, true)+ext)
+}
+
+func (p HfPath) String() string {
+	segs := make([]string, 0, len(p.Shards)+3)
+	segs = append(segs, p.Collection)
+	segs = append(segs, p.Shards...)
+	segs = append(segs, p.ObjectId, p.Name)
+	return "/" + strings.Join(segs, "/")
+}
+
+// Dir eg. /txt/00/00/yyfoatapk5
+func (p HfPath) Dir() string {
+	return path.Dir(p.String())
+}
+
+// Ext eg. .go
+func (p HfPath) Ext() string {
+	return path.Ext(p.Name)
+}
+
+// BaseName is the file name without ext, eg. bdu9kjosiq
+func (p HfPath) BaseName() string {
+	return strings.TrimSuffix(p.Name, p.Ext())
+}
+
+// WithName returns the path of another file in the same object dir.
+func (p HfPath) WithName(name string) HfPath {
+	p.Shards = append([]string(nil), p.Shards...)
+	p.Name = name
+	return p
+}
+
+func (p HfPath) HfLink(clusterId, serverId string) HfLink {
+	return NewHfLink(clusterId, serverId, p.String())
+}
+
+func (d HfLink) HfPath() (HfPath, error) {
+	return ParseHfPath(d.Path())
+}
+
+// Collection returns one of the Collection* constants, or "" if the path has no known collection.
+func (d HfLink) Collection() string {
+	p, err := d.HfPath()
+	if err != nil || !IsCollection(p.Collection) {
+		return ""
+	}
+	return p.Collection
+}
@@ -0,0 +1,83 @@
+package httpfsclient_test
+
+import (
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/RocksonZeta/httpfsclient/util/imageutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHfPath(t *testing.T) {
+	link := httpfsclient.HfLink("static:s1/txt/00/00/yyfoatapk5/bdu9kjosiq.go")
+	p, err := link.HfPath()
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.CollectionTxt, p.Collection)
+	assert.Equal(t, []string{"00", "00"}, p.Shards)
+	assert.Equal(t, "yyfoatapk5", p.ObjectId)
+	assert.Equal(t, "bdu9kjosiq.go", p.Name)
+	assert.Equal(t, ".go", p.Ext())
+	assert.Equal(t, "bdu9kjosiq", p.BaseName())
+	assert.Equal(t, "/txt/00/00/yyfoatapk5", p.Dir())
+	assert.Equal(t, link.Path(), p.String())
+	assert.Equal(t, link, p.HfLink("static", "s1"))
+	assert.Equal(t, "/txt/00/00/yyfoatapk5/a.txt", p.WithName("a.txt").String())
+	assert.Equal(t, httpfsclient.CollectionTxt, link.Collection())
+
+	assert.Equal(t, "", httpfsclient.HfLink("static:s1/nosuch/0/0/a/b.go").Collection())
+	for _, bad := range []string{"/txt/a.go", "/txt/../a/b/c", "/txt/00/../a/b", "/txt/00/00/a/.."} {
+		_, err = httpfsclient.ParseHfPath(bad)
+		assert.NotNil(t, err, bad)
+	}
+
+	// a path written by the server
+	np := httpfsclient.NewHfPath(p.Collection, p.Shards, p.ObjectId, p.Name)
+	assert.Equal(t, link.Path(), np.String())
+	parsed, err := httpfsclient.ParseHfPath(np.String())
+	assert.Nil(t, err)
+	assert.Equal(t, np, parsed)
+
+	rp := httpfsclient.RandomHfPath(httpfsclient.CollectionImage, p.Shards, "jpg")
+	assert.Equal(t, ".jpg", rp.Ext())
+	assert.Equal(t, 10, len(rp.ObjectId))
+	assert.Equal(t, "/image/00/00/"+rp.ObjectId+"/"+rp.Name, rp.String())
+}
+
+func TestVariant(t *testing.T) {
+	link := httpfsclient.HfLink("static:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg")
+	v, err := link.Variant(httpfsclient.VariantSpec{Crop: []int{10, 10, 100, 100}, Width: 60, Height: 60})
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.HfLink("static:s1/image/00/00/gysz2c6aqf/joexrtxyco_c10-10-100-100_60x60.jpg"), v)
+	v, err = link.Variant(httpfsclient.VariantSpec{Width: 60, Height: 60})
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.HfLink("static:s1/image/00/00/gysz2c6aqf/joexrtxyco_60x60.jpg"), v)
+
+	// the resize options are in the name
+	for spec, name := range map[*httpfsclient.VariantSpec]string{
+		{Width: 60, Height: 60, Mode: imageutil.ResizeFit}:                                                     "fit60x60",
+		{Width: 60, Height: 60, Mode: imageutil.ResizeFill}:                                                    "fill60x60",
+		{Width: 60, Mode: imageutil.ResizeWidth}:                                                               "width60x0",
+		{Width: 60, Height: 60, Filter: imageutil.FilterLanczos, NoUpscale: true}:                              "60x60_flanczos_nu",
+		{Width: 60, Height: 60, Mode: imageutil.ResizePad, Background: "#FFF"}:                                 "pad60x60_bffffff",
+		{Crop: []int{0, 0, 50, 50}, Width: 60, Height: 60, Mode: imageutil.ResizePad, Background: "#00000080"}: "c0-0-50-50_pad60x60_b00000080",
+	} {
+		v, err = link.Variant(*spec)
+		assert.Nil(t, err, name)
+		assert.Equal(t, httpfsclient.HfLink("static:s1/image/00/00/gysz2c6aqf/joexrtxyco_"+name+".jpg"), v)
+	}
+
+	for _, spec := range []httpfsclient.VariantSpec{
+		{Crop: []int{1, 2}},
+		{},
+		{Crop: []int{0, 0, 50, 50}, Filter: imageutil.FilterBox},
+		{Width: 60, Height: 60, Mode: "stretch"},
+		{Width: 60, Height: 60, Mode: imageutil.ResizeWidth},
+		{Height: 60, Mode: imageutil.ResizeFit},
+		{Width: 60, Height: 60, Filter: "cubic"},
+		{Width: 60, Height: 60, Background: "#fff"},
+		{Width: 60, Height: 60, Mode: imageutil.ResizePad, Background: "white"},
+	} {
+		_, err = link.Variant(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
@@ -0,0 +1,218 @@
+package httpfsclient
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AliasKeySuffix : the aliases of a cluster are stored in the redis hash clusterId + AliasKeySuffix,
+// field: serverId or serverId + pathPrefix, value: json of ServerAlias
+const AliasKeySuffix = ":alias"
+
+// maximum aliases followed for one link, guards against loops
+const maxAliasHops = 8
+
+// ServerAlias maps the links of a retired server, optionally only under PathPrefix, to their new location.
+// eg. {ClusterId: "static", ServerId: "s1", ToServerId: "s3"} : static:s1/txt/a.go -> static:s3/txt/a.go
+// eg. {ClusterId: "static", ServerId: "s1", PathPrefix: "/video", ToClusterId: "media", ToServerId: "m1", ToPathPrefix: "/old/video"}
+type ServerAlias struct {
+	ClusterId, ServerId string
+	PathPrefix          string `json:",omitempty"`
+	ToClusterId         string `json:",omitempty"` // "" means the same cluster
+	ToServerId          string
+	ToPathPrefix        string `json:",omitempty"`
+}
+
+func (a ServerAlias) field() string {
+	return a.ServerId + a.PathPrefix
+}
+
+func (a ServerAlias) match(serverId, path string) bool {
+	if a.ServerId != serverId {
+		return false
+	}
+	prefix := strings.TrimSuffix(a.PathPrefix, "/")
+	return "" == prefix || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func (a ServerAlias) apply(path string) HfLink {
+	clusterId := a.ToClusterId
+	if "" == clusterId {
+		clusterId = a.ClusterId
+	}
+	rest := strings.TrimPrefix(path, strings.TrimSuffix(a.PathPrefix, "/"))
+	return NewHfLink(clusterId, a.ToServerId, strings.TrimSuffix(a.ToPathPrefix, "/")+rest)
+}
+
+// aliasMu serializes AddAlias, so two aliases making a loop together can not both pass checkAlias
+var aliasMu sync.Mutex
+
+// AddAlias adds or replaces an alias in memory, see SaveServerAlias to store it in redis.
+// An alias making a loop, or a chain longer than maxAliasHops, is rejected.
+func (c *Clusters) AddAlias(alias ServerAlias) error {
+	aliasMu.Lock()
+	defer aliasMu.Unlock()
+	if err := c.checkAlias(alias); err != nil {
+		return err
+	}
+	v, _ := c.clusters.LoadOrStore(alias.ClusterId, &Cluster{Id: alias.ClusterId})
+	v.(*Cluster).addAlias(alias)
+	return nil
+}
+
+// checkAlias follows the aliases from a link under each alias, alias added, they must end at a live location
+// within maxAliasHops without using an alias twice.
+func (c *Clusters) checkAlias(alias ServerAlias) error {
+	var as []ServerAlias
+	if cluster, ok := c.GetCluster(alias.ClusterId); ok {
+		as = cluster.serverAliases(alias.ServerId)
+	}
+	as = withAlias(as, alias)
+	next := func(d HfLink) (ServerAlias, bool) {
+		clusterId, serverId, path := d.Parts()
+		if clusterId == alias.ClusterId && serverId == alias.ServerId {
+			return matchAlias(as, serverId, path)
+		}
+		return c.aliasOf(d)
+	}
+	starts := []ServerAlias{alias}
+	for _, cluster := range c.All() {
+		starts = append(starts, cluster.Aliases()...)
+	}
+	for _, start := range starts {
+		d := NewHfLink(start.ClusterId, start.ServerId, strings.TrimSuffix(start.PathPrefix, "/")+"/x")
+		seen := map[ServerAlias]bool{}
+		for i := 0; ; i++ {
+			a, ok := next(d)
+			if !ok {
+				break
+			}
+			if seen[a] {
+				return errors.New("ServerAlias " + alias.ClusterId + ":" + alias.field() + " makes a loop at " + a.ClusterId + ":" + a.field())
+			}
+			if i == maxAliasHops {
+				return errors.New("ServerAlias " + alias.ClusterId + ":" + alias.field() + " makes a chain longer than " + strconv.Itoa(maxAliasHops))
+			}
+			seen[a] = true
+			_, _, path := d.Parts()
+			d = a.apply(path)
+		}
+	}
+	return nil
+}
+
+// Aliases returns the aliases of a cluster.
+func (c *Clusters) Aliases(clusterId string) []ServerAlias {
+	if cluster, ok := c.GetCluster(clusterId); ok {
+		return cluster.Aliases()
+	}
+	return nil
+}
+
+// Resolve follows the aliases of retired servers, links of live servers are returned as is.
+func (c *Clusters) Resolve(d HfLink) HfLink {
+	for i := 0; i < maxAliasHops; i++ {
+		alias, ok := c.aliasOf(d)
+		if !ok {
+			return d
+		}
+		_, _, path := d.Parts()
+		d = alias.apply(path)
+	}
+	return d
+}
+
+// aliasOf returns the alias matching the link, if any.
+func (c *Clusters) aliasOf(d HfLink) (ServerAlias, bool) {
+	clusterId, serverId, path := d.Parts()
+	cluster, ok := c.GetCluster(clusterId)
+	if !ok {
+		return ServerAlias{}, false
+	}
+	return matchAlias(cluster.serverAliases(serverId), serverId, path)
+}
+
+func (c *Cluster) addAlias(alias ServerAlias) {
+	c.aliases.Store(alias.ServerId, withAlias(c.serverAliases(alias.ServerId), alias))
+}
+
+func (c *Cluster) serverAliases(serverId string) []ServerAlias {
+	if v, ok := c.aliases.Load(serverId); ok {
+		return v.([]ServerAlias)
+	}
+	return nil
+}
+
+// withAlias returns a copy of the aliases of a server with alias added or replaced, longest prefix first.
+func withAlias(aliases []ServerAlias, alias ServerAlias) []ServerAlias {
+	var as []ServerAlias
+	for _, a := range aliases {
+		if a.field() != alias.field() {
+			as = append(as, a)
+		}
+	}
+	as = append(as, alias)
+	sort.Slice(as, func(i, j int) bool { return len(as[i].PathPrefix) > len(as[j].PathPrefix) })
+	return as
+}
+
+func matchAlias(aliases []ServerAlias, serverId, path string) (ServerAlias, bool) {
+	for _, a := range aliases {
+		if a.match(serverId, path) {
+			return a, true
+		}
+	}
+	return ServerAlias{}, false
+}
+
+func (c *Cluster) Aliases() []ServerAlias {
+	var r []ServerAlias
+	c.aliases.Range(func(k, v interface{}) bool {
+		r = append(r, v.([]ServerAlias)...)
+		return true
+	})
+	return r
+}
+
+// Resolve follows the aliases of retired servers, see Clusters.Resolve
+func (d HfLink) Resolve() HfLink {
+	return GetClusters().Resolve(d)
+}
+
+// IsRetired is true if the link points at a retired server and resolves to another location.
+func (d HfLink) IsRetired() bool {
+	return d.Resolve() != d
+}
+
+// RetiredLinks returns the links that still point at retired servers, eg. to migrate the stored links.
+func RetiredLinks(links []HfLink) []HfLink {
+	var r []HfLink
+	for _, d := range links {
+		if d.IsRetired() {
+			r = append(r, d)
+		}
+	}
+	return r
+}
+
+// SaveServerAlias stores the alias in redis and in memory, other clients see it on their next reload.
+func SaveServerAlias(alias ServerAlias) error {
+	if "" == alias.ClusterId || "" == alias.ServerId || "" == alias.ToServerId {
+		return errors.New("ServerAlias needs ClusterId, ServerId and ToServerId")
+	}
+	if nil == redisFactory {
+		return errors.New("clusters not initialized, call InitClusters first")
+	}
+	if err := GetClusters().checkAlias(alias); err != nil {
+		return err
+	}
+	redis := redisFactory.Get()
+	defer redis.Close()
+	if err := redis.HSet(alias.ClusterId+AliasKeySuffix, alias.field(), alias, 0); err != nil {
+		return err
+	}
+	return GetClusters().AddAlias(alias)
+}
@@ -0,0 +1,59 @@
+package httpfsclient_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerAlias(t *testing.T) {
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(nil))
+	cs := httpfsclient.GetClusters()
+	cs.AddServer(httpfsclient.Server{ClusterId: "aliasc", ServerId: "s3", Proxy: "http://s3.alias.test"})
+	cs.AddServer(httpfsclient.Server{ClusterId: "aliasm", ServerId: "m1", Proxy: "http://m1.alias.test"})
+	assert.Nil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasc", ServerId: "s1", ToServerId: "s2"}))
+	assert.Nil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasc", ServerId: "s2", ToServerId: "s3"}))
+	assert.Nil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasc", ServerId: "s1", PathPrefix: "/video", ToClusterId: "aliasm", ToServerId: "m1", ToPathPrefix: "/old/video"}))
+
+	txt := httpfsclient.HfLink("aliasc:s1/txt/00/00/a/b.go")
+	assert.Equal(t, httpfsclient.HfLink("aliasc:s3/txt/00/00/a/b.go"), txt.Resolve())
+	assert.Equal(t, "http://s3.alias.test/txt/00/00/a/b.go", txt.Url())
+	video := httpfsclient.HfLink("aliasc:s1/video/00/00/a/b.mp4")
+	assert.Equal(t, httpfsclient.HfLink("aliasm:m1/old/video/00/00/a/b.mp4"), video.Resolve())
+	assert.Equal(t, "http://m1.alias.test/old/video/00/00/a/b.mp4", video.Url())
+	// prefix matches whole segments only
+	assert.Equal(t, httpfsclient.HfLink("aliasc:s3/videos/a/b/c.mp4"), httpfsclient.HfLink("aliasc:s1/videos/a/b/c.mp4").Resolve())
+
+	live := httpfsclient.HfLink("aliasc:s3/txt/00/00/a/c.go")
+	assert.Equal(t, live, live.Resolve())
+	assert.Equal(t, []httpfsclient.HfLink{txt, video}, httpfsclient.RetiredLinks([]httpfsclient.HfLink{txt, live, video}))
+	assert.Equal(t, 3, len(cs.Aliases("aliasc")))
+
+	// loops and too long chains are rejected
+	assert.Nil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasl", ServerId: "a", ToServerId: "b"}))
+	assert.NotNil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasl", ServerId: "b", ToServerId: "a"}))
+	assert.NotNil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasl", ServerId: "b", PathPrefix: "/x", ToServerId: "a"}))
+	assert.NotNil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasl", ServerId: "b", ToServerId: "b"}))
+	assert.Equal(t, httpfsclient.HfLink("aliasl:b/x/y"), httpfsclient.HfLink("aliasl:a/x/y").Resolve())
+	assert.Equal(t, 1, len(cs.Aliases("aliasl")))
+	for i := 0; i < 8; i++ {
+		assert.Nil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasn", ServerId: "s" + strconv.Itoa(i), ToServerId: "s" + strconv.Itoa(i+1)}))
+	}
+	assert.NotNil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasn", ServerId: "t", ToServerId: "s0"}))
+	assert.NotNil(t, cs.AddAlias(httpfsclient.ServerAlias{ClusterId: "aliasn", ServerId: "s8", ToServerId: "s9"}))
+	assert.Equal(t, httpfsclient.HfLink("aliasn:s8/x/y"), httpfsclient.HfLink("aliasn:s0/x/y").Resolve())
+}
+
+func TestSaveServerAliasLoop(t *testing.T) {
+	r := newMemRedis()
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(r.factory()))
+	assert.Nil(t, httpfsclient.SaveServerAlias(httpfsclient.ServerAlias{ClusterId: "aliass", ServerId: "a", ToServerId: "b"}))
+	r.stats()
+	assert.NotNil(t, httpfsclient.SaveServerAlias(httpfsclient.ServerAlias{ClusterId: "aliass", ServerId: "b", ToServerId: "a"}))
+	_, commands := r.stats()
+	assert.Empty(t, commands)
+	assert.Equal(t, 1, len(r.hashes["aliass"+httpfsclient.AliasKeySuffix]))
+	assert.Equal(t, httpfsclient.HfLink("aliass:b/x/y"), httpfsclient.HfLink("aliass:a/x/y").Resolve())
+}
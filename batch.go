@@ -0,0 +1,157 @@
+package httpfsclient
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/RocksonZeta/httpfsclient/util/httputil"
+)
+
+// BatchMaxCalls is the most calls sent to a server in one request, bigger batches are split.
+var BatchMaxCalls = 100
+
+// BatchCall is one call of a batch. Link selects the server, Result receives the data like the result of Call.
+type BatchCall struct {
+	Link           HfLink
+	Module, Method string
+	Args           interface{}
+	Result         interface{}
+}
+
+// POST /call/batch args=[{Module,Method,Args}...] -> Data: [{State,Data,Err}...] in the same order
+type batchRequest struct {
+	Module, Method string
+	Args           interface{}
+}
+type batchResponse struct {
+	State int
+	Data  json.RawMessage
+	Err   string
+}
+
+// CallBatch sends all calls to this server in one request, the errors are in the order of calls.
+func (c *Client) CallBatch(calls []BatchCall) []error {
+	return c.callBatches(calls, "")
+}
+
+// callBatches sends the calls in requests of BatchMaxCalls calls, the n-th request with the key idemKey/n if idemKey is set.
+func (c *Client) callBatches(calls []BatchCall, idemKey string) []error {
+	errs := make([]error, len(calls))
+	for start := 0; start < len(calls); start += BatchMaxCalls {
+		end := start + BatchMaxCalls
+		if end > len(calls) {
+			end = len(calls)
+		}
+		key := ""
+		if "" != idemKey {
+			key = idemKey + "/" + strconv.Itoa(start/BatchMaxCalls)
+		}
+		copy(errs[start:end], c.callBatch(calls[start:end], idempotencyKey(key)))
+	}
+	return errs
+}
+
+func (c *Client) callBatch(calls []BatchCall, key string) []error {
+	errs := make([]error, len(calls))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	reqs := make([]batchRequest, len(calls))
+	for i, call := range calls {
+		reqs[i] = batchRequest{Module: call.Module, Method: call.Method, Args: call.Args}
+	}
+	jsonArgs, err := json.Marshal(reqs)
+	if err != nil {
+		return fail(err)
+	}
+	status, bs, err := httputil.HttpPostFormIdempotent3(c.Server+"/call/batch", map[string]string{"args": string(jsonArgs)}, nil, key)
+	if err != nil {
+		return fail(err)
+	}
+	if status != 200 {
+		return fail(errors.New(string(bs)))
+	}
+	var resps []batchResponse
+	if err = ParseResult(bs, &resps); err != nil {
+		return fail(err)
+	}
+	if len(resps) != len(calls) {
+		return fail(errors.New("batch call: " + strconv.Itoa(len(calls)) + " calls but " + strconv.Itoa(len(resps)) + " results"))
+	}
+	for i, r := range resps {
+		switch {
+		case r.State != StateOk:
+			errs[i] = errors.New(r.Err)
+		case nil != calls[i].Result && len(r.Data) > 0:
+			errs[i] = json.Unmarshal(r.Data, calls[i].Result)
+		}
+	}
+	return errs
+}
+
+// Batch groups the calls by server, sends one request per server concurrently, and returns the errors in the order of calls.
+func (m Methods) Batch(calls []BatchCall) []error {
+	errs := make([]error, len(calls))
+	groups := map[string][]int{} // clusterId:serverId => indexes of calls
+	for i, call := range calls {
+		clusterId, serverId, _ := call.Link.Resolve().Parts()
+		server := GetServer(clusterId, serverId)
+		if "" == server.ClusterId {
+			errs[i] = errors.New("no such server:" + string(call.Link))
+			continue
+		}
+		groups[server.Id()] = append(groups[server.Id()], i)
+	}
+	var wg sync.WaitGroup
+	for id, indexes := range groups {
+		wg.Add(1)
+		go func(id string, indexes []int) {
+			defer wg.Done()
+			clusterId, serverId, _ := HfLink(id + "/").Parts()
+			group := make([]BatchCall, len(indexes))
+			for i, index := range indexes {
+				group[i] = calls[index]
+			}
+			key := ""
+			if "" != m.IdempotencyKey {
+				key = m.IdempotencyKey + "/" + id
+			}
+			for i, err := range (&Client{Server: GetServer(clusterId, serverId).Local}).callBatches(group, key) {
+				errs[indexes[i]] = err
+			}
+		}(id, indexes)
+	}
+	wg.Wait()
+	return errs
+}
+
+// ImageCropResizeBatch crops and resizes many images, with one request per server.
+func (m Methods) ImageCropResizeBatch(links []HfLink, crop []int, sizes [][]int) ([][]HfLink, []error) {
+	if err := checkCropResize(crop, sizes); err != nil {
+		errs := make([]error, len(links))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([][]HfLink, len(links)), errs
+	}
+	calls := make([]BatchCall, len(links))
+	paths := make([][]string, len(links))
+	for i, hf := range links {
+		calls[i] = BatchCall{Link: hf, Module: "image", Method: "cropresize", Args: ImageTransformParam{FilePath: hf.Resolve().Path(), Crop: crop, Resize: sizes}, Result: &paths[i]}
+	}
+	errs := m.Batch(calls)
+	result := make([][]HfLink, len(links))
+	for i, hf := range links {
+		if errs[i] != nil {
+			continue
+		}
+		clusterId, serverId, _ := hf.Resolve().Parts()
+		result[i], errs[i] = toHfLinks(clusterId, serverId, paths[i])
+	}
+	return result, errs
+}
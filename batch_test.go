@@ -0,0 +1,64 @@
+package httpfsclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchServer answers /call/batch with the FilePath of every cropresize call, or an error for other methods.
+func batchServer(t *testing.T, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/call/batch", r.URL.Path)
+		atomic.AddInt32(requests, 1)
+		var calls []struct {
+			Module, Method string
+			Args           httpfsclient.ImageTransformParam
+		}
+		assert.Nil(t, json.Unmarshal([]byte(r.FormValue("args")), &calls))
+		var results []map[string]interface{}
+		for _, c := range calls {
+			if "cropresize" == c.Method {
+				results = append(results, map[string]interface{}{"State": 0, "Data": []string{c.Args.FilePath + "_60x60"}})
+			} else {
+				results = append(results, map[string]interface{}{"State": 1, "Err": "no such method:" + c.Method})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"State": 0, "Data": results})
+	}))
+}
+
+func TestBatch(t *testing.T) {
+	var n1, n2 int32
+	s1, s2 := batchServer(t, &n1), batchServer(t, &n2)
+	defer s1.Close()
+	defer s2.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "batchc", ServerId: "s1", Local: s1.URL})
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "batchc", ServerId: "s2", Local: s2.URL})
+
+	links := []httpfsclient.HfLink{"batchc:s1/image/0/0/a/1.jpg", "batchc:s2/image/0/0/a/2.jpg", "batchc:s1/image/0/0/a/3.jpg", "nosuch:s1/image/0/0/a/4.jpg"}
+	result, errs := httpfsclient.Methods{}.ImageCropResizeBatch(links, nil, [][]int{{60, 60}})
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.Nil(t, errs[2])
+	assert.NotNil(t, errs[3])
+	assert.Equal(t, []httpfsclient.HfLink{"batchc:s1/image/0/0/a/1.jpg_60x60"}, result[0])
+	assert.Equal(t, []httpfsclient.HfLink{"batchc:s2/image/0/0/a/2.jpg_60x60"}, result[1])
+	assert.Equal(t, []httpfsclient.HfLink{"batchc:s1/image/0/0/a/3.jpg_60x60"}, result[2])
+	assert.Equal(t, int32(1), n1)
+	assert.Equal(t, int32(1), n2)
+
+	var r []string
+	errs = httpfsclient.Methods{}.Batch([]httpfsclient.BatchCall{
+		{Link: links[0], Module: "image", Method: "nosuch"},
+		{Link: links[0], Module: "image", Method: "cropresize", Args: httpfsclient.ImageTransformParam{FilePath: "/x"}, Result: &r},
+	})
+	assert.EqualError(t, errs[0], "no such method:nosuch")
+	assert.Nil(t, errs[1])
+	assert.Equal(t, []string{"/x_60x60"}, r)
+}
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"net/http"
 
+	"github.com/RocksonZeta/httpfsclient/util/hashutil"
 	"github.com/RocksonZeta/httpfsclient/util/httputil"
+	"github.com/RocksonZeta/httpfsclient/util/imageutil"
 	"github.com/mozillazg/request"
 )
 
@@ -31,6 +34,14 @@ type Client struct {
 	Server string
 }
 
+// idempotencyKey returns key, or a new random key for one request.
+func idempotencyKey(key string) string {
+	if "" == key {
+		return hashutil.RandomStr32()
+	}
+	return key
+}
+
 func ParseResult(bs []byte, result interface{}) error {
 	var jr JsonResult
 	jr.Data = result
@@ -57,24 +68,56 @@ func (c *Client) Read(filePath string) ([]byte, error) {
 	return bs, err
 }
 func (c *Client) Call(module, method string, args interface{}, result interface{}) error {
+	return c.call(module, method, args, result, "")
+}
+
+// call calls with an idempotency key, a random key if "".
+func (c *Client) call(module, method string, args interface{}, result interface{}, key string) error {
 	jsonArgs, err := json.Marshal(args)
 	if err != nil {
 		return err
 	}
-	status, bs, err := httputil.HttpPostForm3(c.Server+"/call/"+module+"/"+method, map[string]string{"args": string(jsonArgs)}, nil)
+	status, bs, err := httputil.HttpPostFormIdempotent3(c.Server+"/call/"+module+"/"+method, map[string]string{"args": string(jsonArgs)}, nil, idempotencyKey(key))
 	if err != nil {
 		return err
 	}
 	if status != 200 {
-		return errors.New(string(bs))
+		return &CallError{Status: status, Body: string(bs)}
 	}
 	return ParseResult(bs, result)
 }
 
+// CallError is returned by Call and the writes when the server answers with a status other than 200, or a write fails.
+type CallError struct {
+	Status int
+	Body   string
+}
+
+func (e *CallError) Error() string {
+	return e.Body
+}
+
+// IsMethodNotFound tells if err is a call to a module or method the server does not have.
+func IsMethodNotFound(err error) bool {
+	e, ok := err.(*CallError)
+	return ok && (e.Status == http.StatusNotFound || e.Status == http.StatusNotImplemented)
+}
+
 type ImageTransformParam struct {
 	FilePath string
 	Crop     []int
 	Resize   [][]int
+	// Mode is how to resize to the sizes, one of the imageutil.Resize* modes, "" stretches.
+	Mode string `json:",omitempty"`
+	// Filter is one of the imageutil.Filter* filters, "" is linear.
+	Filter string `json:",omitempty"`
+	// Background is the color of imageutil.ResizePad as #rrggbb, "" is transparent.
+	Background string `json:",omitempty"`
+	// NoUpscale keeps the images smaller than a size as they are.
+	NoUpscale bool `json:",omitempty"`
+	// Targets are the paths to write the outputs to, instead of generated ones. Targets[i] is the output of Resize[i],
+	// or of the crop if there is no resize. Used by EnsureVariant.
+	Targets []string `json:",omitempty"`
 }
 
 func (c *Client) ImageCropResize(filePath string, crop []int, sizes [][]int) (result []string, err error) {
@@ -94,13 +137,37 @@ func (w *Writer) Write(reader io.Reader, fileName, collection string) (HfLink, e
 	return WriteServer(server, reader, fileName, collection)
 }
 func WriteServer(server Server, reader io.Reader, fileName, collection string) (HfLink, error) {
-	_, bs, err := httputil.HttpPostForm3(server.Local+"/fs/write/"+collection, nil, []request.FileField{{FieldName: "file", FileName: fileName, File: reader}})
+	return WriteServerKey(server, reader, fileName, collection, "")
+}
+
+// WriteServerKey writes with an idempotency key, a write retried with the same key is stored once.
+// Failed posts are retried only if reader is an io.Seeker, eg. *os.File or *bytes.Reader.
+func WriteServerKey(server Server, reader io.Reader, fileName, collection, key string) (HfLink, error) {
+	status, bs, err := httputil.HttpPostFormIdempotent3(server.Local+"/fs/write/"+collection, nil, []request.FileField{{FieldName: "file", FileName: fileName, File: reader}}, idempotencyKey(key))
+	if err != nil {
+		return HfLink(""), err
+	}
+	var jr struct {
+		State int
+		Data  json.RawMessage
+	}
+	if status != http.StatusOK || json.Unmarshal(bs, &jr) != nil || jr.State != StateOk {
+		return HfLink(""), &CallError{Status: status, Body: string(bs)}
+	}
 	var rpath string
-	ParseResult(bs, &rpath)
-	return NewHfLink(server.ClusterId, server.ServerId, rpath), err
+	if err = json.Unmarshal(jr.Data, &rpath); err != nil {
+		return HfLink(""), err
+	}
+	return ParseHfLink(server.ClusterId + ":" + server.ServerId + rpath)
 }
 
 func Write(reader io.Reader, clusterId, fileName, collection string) (HfLink, error) {
+	return WriteKey(reader, clusterId, fileName, collection, "")
+}
+
+// WriteKey writes to the server with the most free space, with an idempotency key.
+// The key only dedups retries on the same server: to retry a failed WriteKey, use WriteServerKey with the server of the failed attempt.
+func WriteKey(reader io.Reader, clusterId, fileName, collection, key string) (HfLink, error) {
 	cluster, ok := GetClusters().GetCluster(clusterId)
 	if !ok {
 		return HfLink(""), errors.New("no such cluster:" + clusterId)
@@ -109,65 +176,121 @@ func Write(reader io.Reader, clusterId, fileName, collection string) (HfLink, er
 	if "" == server.Local {
 		return HfLink(""), errors.New(" cluster '" + clusterId + "' no avaiable server.")
 	}
-	return WriteServer(server, reader, fileName, collection)
+	return WriteServerKey(server, reader, fileName, collection, key)
 }
 
+// typed stubs of the server modules, see modules.json
+//go:generate go run ./cmd/hfgen -spec modules.json -out modules_gen.go
+
 type Methods struct {
+	// CallbackUrl, if set, is posted to by the server when an async call finishes, see WebhookHandler.
+	CallbackUrl string
+	// IdempotencyKey is sent with the calls, a random key per call if "". Set it to retry a call of your own safely.
+	// The key is scoped by module/method, so it stands for one call of each method: to make several calls of a method,
+	// eg. for several files, use a key per call. An async call with a key always gets the same job id and progress key.
+	IdempotencyKey string
+}
+
+// callKey is IdempotencyKey scoped by module/method, "" if not set.
+func (c Methods) callKey(module, method string) string {
+	if "" == c.IdempotencyKey {
+		return ""
+	}
+	return c.IdempotencyKey + "/" + module + "/" + method
 }
 
 func (c Methods) Call(clusterId, serverId, module, method string, args interface{}, result interface{}) error {
+	server := GetClusters().GetServer(clusterId, serverId)
+	return (&Client{Server: server.Local}).call(module, method, args, result, c.callKey(module, method))
+}
+
+// CallAsync starts module.method on the server and returns at once, the job reports to a progress key of its own.
+func (c Methods) CallAsync(clusterId, serverId, module, method string, args interface{}) (*Job, error) {
+	return c.callAsync(c.newJob(clusterId, serverId, module, method, ""), args)
+}
+
+// callAsync posts args with the job id and the progress key, the server writes JobProgress records to that key.
+func (c Methods) callAsync(job *Job, args interface{}) (*Job, error) {
 	jsonArgs, err := json.Marshal(args)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	server := GetClusters().GetServer(clusterId, serverId)
-	status, bs, err := httputil.HttpPostForm3(server.Local+"/call/"+module+"/"+method, map[string]string{"args": string(jsonArgs)}, nil)
+	form := map[string]string{"args": string(jsonArgs), "job": job.Id, "progress": job.ProgressKey}
+	if "" != c.CallbackUrl {
+		form["callback"] = c.CallbackUrl
+	}
+	server := GetClusters().GetServer(job.ClusterId, job.ServerId)
+	status, bs, err := httputil.HttpPostFormIdempotent3(server.Local+"/call/async/"+job.Module+"/"+job.Method, form, nil, idempotencyKey(c.callKey(job.Module, job.Method)))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if status != 200 {
-		return errors.New(string(bs))
+		return nil, errors.New(string(bs))
 	}
-	return ParseResult(bs, result)
+	return job, ParseResult(bs, nil)
 }
-func (c Methods) CallAsync(clusterId, serverId, module, method string, args interface{}) error {
-	jsonArgs, err := json.Marshal(args)
-	if err != nil {
+
+func (p ImageTransformParam) Validate() error {
+	if err := checkCropResize(p.Crop, p.Resize); err != nil {
 		return err
 	}
-	server := GetClusters().GetServer(clusterId, serverId)
-	status, bs, err := httputil.HttpPostForm3(server.Local+"/call/async/"+module+"/"+method, map[string]string{"args": string(jsonArgs)}, nil)
-	if err != nil {
-		return err
+	if !imageutil.IsResizeMode(p.Mode) {
+		return errors.New("ImageCropResize mode param error. unknown mode:" + p.Mode)
 	}
-	if status != 200 {
-		return errors.New(string(bs))
+	if !imageutil.IsFilter(p.Filter) {
+		return errors.New("ImageCropResize filter param error. unknown filter:" + p.Filter)
+	}
+	if "" != p.Background {
+		if _, err := imageutil.ParseColor(p.Background); err != nil {
+			return errors.New("ImageCropResize background param error. background must be #rrggbb.")
+		}
 	}
-	return ParseResult(bs, nil)
+	return nil
 }
 
-func (m Methods) ImageCropResize(hf HfLink, crop []int, sizes [][]int) ([]HfLink, error) {
+func checkCropResize(crop []int, sizes [][]int) error {
 	if len(crop) != 0 && len(crop) != 4 {
-		return nil, errors.New("ImageCropResize crop param error. crop must be [x,y,w,h].")
+		return errors.New("ImageCropResize crop param error. crop must be [x,y,w,h].")
 	}
 	if len(sizes) > 0 {
 		for _, size := range sizes {
 			if len(size) != 2 {
-				return nil, errors.New("ImageCropResize sizes param error. sizes must be [[w,h]].")
+				return errors.New("ImageCropResize sizes param error. sizes must be [[w,h]].")
 			}
 		}
 	}
-	clusterId, serverId, path := hf.Parts()
+	return nil
+}
+
+// toHfLinks turns the paths returned by a server into links.
+func toHfLinks(clusterId, serverId string, paths []string) ([]HfLink, error) {
+	result := make([]HfLink, len(paths))
+	for i, v := range paths {
+		var err error
+		if result[i], err = ParseHfLink(clusterId + ":" + serverId + v); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (m Methods) ImageCropResize(hf HfLink, crop []int, sizes [][]int) ([]HfLink, error) {
+	return m.ImageCropResizeParam(hf, ImageTransformParam{Crop: crop, Resize: sizes})
+}
+
+// ImageCropResizeParam crops and resizes with the resize mode and filter of param, param.FilePath is set from hf.
+func (m Methods) ImageCropResizeParam(hf HfLink, param ImageTransformParam) ([]HfLink, error) {
+	if err := param.Validate(); err != nil {
+		return nil, err
+	}
+	clusterId, serverId, path := hf.Resolve().Parts()
+	param.FilePath = path
 	var resultPaths []string
-	err := m.Call(clusterId, serverId, "image", "cropresize", ImageTransformParam{FilePath: path, Crop: crop, Resize: sizes}, &resultPaths)
+	err := m.Call(clusterId, serverId, "image", "cropresize", param, &resultPaths)
 	if err != nil {
 		return nil, err
 	}
-	result := make([]HfLink, len(resultPaths))
-	for i, v := range resultPaths {
-		result[i] = NewHfLink(clusterId, serverId, v)
-	}
-	return result, nil
+	return toHfLinks(clusterId, serverId, resultPaths)
 }
 
 type VideoCompressParam struct {
@@ -176,11 +299,14 @@ type VideoCompressParam struct {
 	VideoId          int
 }
 
-func (m Methods) VideoCompressDash(hf HfLink, videoId int, progressKey string) error {
-	clusterId, serverId, path := hf.Parts()
-	return m.CallAsync(clusterId, serverId, "video", "CompressDash", VideoCompressParam{VideoId: videoId, File: path, ProgressRedisKey: progressKey})
+// VideoCompressDash reports to progressKey, or to a key of its own if progressKey is "".
+func (m Methods) VideoCompressDash(hf HfLink, videoId int, progressKey string) (*Job, error) {
+	clusterId, serverId, path := hf.Resolve().Parts()
+	job := m.newJob(clusterId, serverId, "video", "CompressDash", progressKey)
+	return m.callAsync(job, VideoCompressParam{VideoId: videoId, File: path, ProgressRedisKey: job.ProgressKey})
 }
-func (m Methods) Mp4(hf HfLink, videoId int, progressKey string) error {
-	clusterId, serverId, path := hf.Parts()
-	return m.CallAsync(clusterId, serverId, "video", "Mp4", VideoCompressParam{VideoId: videoId, File: path, ProgressRedisKey: progressKey})
+func (m Methods) Mp4(hf HfLink, videoId int, progressKey string) (*Job, error) {
+	clusterId, serverId, path := hf.Resolve().Parts()
+	job := m.newJob(clusterId, serverId, "video", "Mp4", progressKey)
+	return m.callAsync(job, VideoCompressParam{VideoId: videoId, File: path, ProgressRedisKey: job.ProgressKey})
 }
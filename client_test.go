@@ -1,11 +1,16 @@
 package httpfsclient_test
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
 	"github.com/RocksonZeta/httpfsclient"
+	"github.com/RocksonZeta/httpfsclient/util/httputil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,8 +38,9 @@ func TestBasic(t *testing.T) {
 func TestVideo(t *testing.T) {
 	httpfsclient.InitClusters(redisAddr, "", "0", clusterId)
 	link := httpfsclient.HfLink("static:s1/video/0/0/9o39m9wuvi/4uie3br1wj.mp4")
-	err := link.VideoCompressDash("v1/progress")
+	job, err := link.VideoCompressDash(1, "v1/progress")
 	assert.Nil(t, err)
+	assert.Equal(t, "v1/progress", job.ProgressKey)
 }
 func TestImage(t *testing.T) {
 	httpfsclient.InitClusters(redisAddr, "", "0", clusterId)
@@ -43,3 +49,85 @@ func TestImage(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(links))
 }
+
+func TestWriteRetryIdempotent(t *testing.T) {
+	var keys, bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(httputil.HeaderIdempotencyKey))
+		f, _, err := r.FormFile("file")
+		assert.Nil(t, err)
+		bs, _ := ioutil.ReadAll(f)
+		bodies = append(bodies, string(bs))
+		if len(keys) == 1 { // accepted, but the response is lost
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"State":0,"Data":"/txt/00/00/yyfoatapk5/bdu9kjosiq.txt"}`))
+	}))
+	defer ts.Close()
+	server := httpfsclient.Server{ClusterId: "idemc", ServerId: "s1", Local: ts.URL}
+	link, err := httpfsclient.WriteServerKey(server, bytes.NewReader([]byte("hello")), "a.txt", httpfsclient.CollectionTxt, "upload-1")
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.HfLink("idemc:s1/txt/00/00/yyfoatapk5/bdu9kjosiq.txt"), link)
+	assert.Equal(t, []string{"upload-1", "upload-1"}, keys)
+	assert.Equal(t, []string{"hello", "hello"}, bodies)
+
+	keys = nil
+	_, err = httpfsclient.WriteServer(server, bytes.NewReader([]byte("hello")), "a.txt", httpfsclient.CollectionTxt)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(keys))
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, 32, len(keys[0]))
+}
+
+func TestWriterKeys(t *testing.T) {
+	done := map[string]string{} // idempotency key => path, like the server
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(httputil.HeaderIdempotencyKey)
+		if _, ok := done[key]; !ok {
+			f, _, _ := r.FormFile("file")
+			bs, _ := ioutil.ReadAll(f)
+			done[key] = "/txt/00/00/yyfoatapk5/" + string(bs) + ".txt"
+		}
+		w.Write([]byte(`{"State":0,"Data":"` + done[key] + `"}`))
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "writerc", ServerId: "s1", Local: ts.URL})
+
+	w := &httpfsclient.Writer{ClusterId: "writerc", ServerId: "s1"}
+	a, err := w.Write(bytes.NewReader([]byte("aaaaaaaaaa")), "a.txt", httpfsclient.CollectionTxt)
+	assert.Nil(t, err)
+	b, err := w.Write(bytes.NewReader([]byte("bbbbbbbbbb")), "b.txt", httpfsclient.CollectionTxt)
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.HfLink("writerc:s1/txt/00/00/yyfoatapk5/aaaaaaaaaa.txt"), a)
+	assert.Equal(t, httpfsclient.HfLink("writerc:s1/txt/00/00/yyfoatapk5/bbbbbbbbbb.txt"), b)
+}
+
+func TestWriteError(t *testing.T) {
+	var status int
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+	server := httpfsclient.Server{ClusterId: "writeerrc", ServerId: "s1", Local: ts.URL}
+	for _, c := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusConflict, "request in progress"},
+		{http.StatusInternalServerError, "disk full"},
+		{http.StatusOK, `{"State":1,"Err":"bad collection"}`},
+		{http.StatusOK, "not json"},
+	} {
+		status, body = c.status, c.body
+		_, err := httpfsclient.WriteServer(server, bytes.NewReader([]byte("hello")), "a.txt", httpfsclient.CollectionTxt)
+		e, ok := err.(*httpfsclient.CallError)
+		if assert.True(t, ok, c.body) {
+			assert.Equal(t, c.status, e.Status)
+			assert.Equal(t, c.body, e.Body)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 var clusters *Clusters
 var serverUts sync.Map
+var redisFactory *kv.ServiceFactory
 
 func init() {
 	serverUts = sync.Map{} //clusterId:serverId => ServerUt
@@ -37,6 +38,7 @@ func InitClusters(url string, clusterIds ...string) {
 		Url: url,
 	}
 	factory := kv.NewFactory(&conf)
+	redisFactory = factory
 	load(factory, clusterIds...)
 	go func() {
 		ticker := time.NewTicker(60 * time.Second)
@@ -61,6 +63,12 @@ func load(factory *kv.ServiceFactory, clusterIds ...string) {
 			v.available = available(v)
 			cluster.servers.Store(k, v)
 		}
+		var aliases map[string]ServerAlias
+		redis.HMGetAll(cid+AliasKeySuffix, &aliases)
+		for _, a := range aliases {
+			a.ClusterId = cid
+			cluster.addAlias(a)
+		}
 		clusters.clusters.Store(cid, cluster)
 	}
 }
@@ -90,12 +98,27 @@ type Clusters struct {
 	clusters sync.Map // clusterId :*Server
 }
 
+func (c *Clusters) All() []*Cluster {
+	var r []*Cluster
+	c.clusters.Range(func(k, v interface{}) bool {
+		r = append(r, v.(*Cluster))
+		return true
+	})
+	return r
+}
 func (c *Clusters) GetCluster(clusterId string) (*Cluster, bool) {
 	if cluster, ok := c.clusters.Load(clusterId); ok {
 		return cluster.(*Cluster), ok
 	}
 	return nil, false
 }
+
+// AddServer adds or replaces a server, useful when the servers are not loaded from redis.
+func (c *Clusters) AddServer(server Server) {
+	v, _ := c.clusters.LoadOrStore(server.ClusterId, &Cluster{Id: server.ClusterId})
+	server.available = true
+	v.(*Cluster).servers.Store(server.ServerId, server)
+}
 func (c *Clusters) GetServer(clusterId, serverId string) Server {
 	if cluster, ok := c.clusters.Load(clusterId); ok {
 		return cluster.(*Cluster).GetServer(serverId)
@@ -123,6 +146,16 @@ type Cluster struct {
 	Id string
 	// serverm map[string]Server //serverId : Server
 	servers sync.Map //serverId : Server
+	aliases sync.Map //retired serverId : []ServerAlias
+}
+
+func (c *Cluster) Servers() []Server {
+	var r []Server
+	c.servers.Range(func(k, v interface{}) bool {
+		r = append(r, v.(Server))
+		return true
+	})
+	return r
 }
 
 func (c Cluster) ChooseServer() Server {
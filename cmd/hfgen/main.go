@@ -0,0 +1,347 @@
+// hfgen generates typed client stubs for the /call methods of httpfs server modules.
+//
+//	//go:generate go run ./cmd/hfgen -spec modules.json -out modules_gen.go
+//
+// The generated code declares methods on HfLink and uses the internals of the package, so it belongs to package httpfsclient.
+// The spec is json:
+//
+//	{
+//	  "modules": [{
+//	    "module": "image",                 // /call/image/...
+//	    "type": "ImageModule",             // generated type, also the name of its HfLink accessor
+//	    "methods": [{
+//	      "method": "cropresize",          // /call/image/cropresize
+//	      "name": "CropResize",            // go method, the async one is CropResizeAsync
+//	      "modes": ["sync", "async"],      // default both
+//	      "fileField": "FilePath",         // set to the link's path
+//	      "progressField": "",             // set to the job's progress key on async calls
+//	      "result": "links",               // "links": server paths as []HfLink, "none", or a go type
+//	      "args": "",                      // a hand written args type with a Validate() error, instead of fields
+//	      "fields": [
+//	        {"name": "FilePath", "type": "string"},
+//	        {"name": "Crop", "type": "[]int", "len": [0, 4], "msg": "crop must be [x,y,w,h]."},
+//	        {"name": "Resize", "type": "[][]int", "itemLen": [2], "msg": "sizes must be [[w,h]]."}
+//	      ]
+//	    }]
+//	  }]
+//	}
+//
+// Without args, the args type ImageCropResizeArgs is generated from the fields.
+// Field checks: required (non zero, empty for slices and maps), len / itemLen (allowed lengths of a slice / of its items),
+// min / max (number types only), oneOf (strings). msg is appended to the error.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+type Spec struct {
+	Modules []Module
+}
+
+type Module struct {
+	Module  string
+	Type    string
+	Methods []Method
+}
+
+type Method struct {
+	Method        string
+	Name          string
+	Modes         []string
+	FileField     string
+	ProgressField string
+	Result        string
+	Args          string
+	Fields        []Field
+	ArgsType      string `json:"-"` // Args, or the generated type
+}
+
+type Field struct {
+	Name     string
+	Type     string
+	Json     string
+	Required bool
+	Len      []int
+	ItemLen  []int
+	Min      *float64
+	Max      *float64
+	OneOf    []string
+	Msg      string
+}
+
+func (m Method) Sync() bool  { return len(m.Modes) == 0 || contains(m.Modes, "sync") }
+func (m Method) Async() bool { return len(m.Modes) == 0 || contains(m.Modes, "async") }
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Method) ResultType() string {
+	switch m.Result {
+	case "links":
+		return "[]HfLink"
+	case "", "none":
+		return ""
+	}
+	return m.Result
+}
+
+// lenCond is true when length l is not allowed, eg. !(l == 0 || l == 4)
+func lenCond(lens []int) string {
+	cs := make([]string, len(lens))
+	for i, l := range lens {
+		cs[i] = fmt.Sprintf("l == %d", l)
+	}
+	return "!(" + strings.Join(cs, " || ") + ")"
+}
+
+func quoteAll(ss []string) string {
+	qs := make([]string, len(ss))
+	for i, s := range ss {
+		qs[i] = fmt.Sprintf("%q", s)
+	}
+	return strings.Join(qs, ", ")
+}
+
+func isNumber(typ string) bool {
+	switch typ {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "byte", "rune":
+		return true
+	}
+	return false
+}
+
+// zeroCond is true when the field is zero, by the kind of its type.
+func zeroCond(f Field) string {
+	v := "a." + f.Name
+	switch {
+	case strings.HasPrefix(f.Type, "[]") || strings.HasPrefix(f.Type, "map["):
+		return "len(" + v + ") == 0"
+	case strings.HasPrefix(f.Type, "*") || strings.HasPrefix(f.Type, "func(") || strings.HasPrefix(f.Type, "chan ") || strings.HasPrefix(f.Type, "interface{"):
+		return v + " == nil"
+	case "string" == f.Type:
+		return `"" == ` + v
+	case "bool" == f.Type:
+		return "!" + v
+	case isNumber(f.Type):
+		return v + " == 0"
+	}
+	return v + " == *new(" + f.Type + ")" // a named type, it must be comparable
+}
+
+func (f Field) checked() bool {
+	return f.Required || len(f.Len) > 0 || len(f.ItemLen) > 0 || nil != f.Min || nil != f.Max || len(f.OneOf) > 0
+}
+
+func validate(f Field) error {
+	if "" == f.Name || "" == f.Type {
+		return fmt.Errorf("field needs name and type: %+v", f)
+	}
+	if (nil != f.Min || nil != f.Max) && !isNumber(f.Type) {
+		return fmt.Errorf("field %s: min and max need a number type, not %s", f.Name, f.Type)
+	}
+	return nil
+}
+
+var tmpl = template.Must(template.New("gen").Funcs(template.FuncMap{
+	"lenCond": lenCond, "quoteAll": quoteAll, "zeroCond": zeroCond,
+	"num": func(f *float64) float64 { return *f },
+	"errMsg": func(module, method string, f Field, what string) string {
+		s := module + "/" + method + " " + f.Name + " " + what
+		if "" != f.Msg {
+			s += ". " + f.Msg
+		}
+		return fmt.Sprintf("%q", s)
+	},
+}).Parse(`// Code generated by hfgen from {{.Source}}. DO NOT EDIT.
+
+package httpfsclient
+{{if .NeedErrors}}
+import (
+	"errors"
+)
+{{end}}{{range $mod := .Spec.Modules}}
+// {{$mod.Type}} calls the methods of the server module {{$mod.Module}} on the server of Link.
+type {{$mod.Type}} struct {
+	Link    HfLink
+	Methods Methods
+}
+
+func (d HfLink) {{$mod.Type}}() {{$mod.Type}} {
+	return {{$mod.Type}}{Link: d}
+}
+{{range $m := $mod.Methods}}{{if not $m.Args}}
+// {{$m.ArgsType}} are the args of /call/{{$mod.Module}}/{{$m.Method}}
+type {{$m.ArgsType}} struct {
+{{- range $f := $m.Fields}}
+	{{$f.Name}} {{$f.Type}}{{if $f.Json}} ` + "`json:\"{{$f.Json}}\"`" + `{{end}}
+{{- end}}
+}
+
+func (a {{$m.ArgsType}}) Validate() error {
+{{- range $f := $m.Fields}}
+{{- if $f.Required}}
+	if {{zeroCond $f}} {
+		return errors.New({{errMsg $mod.Module $m.Method $f "is required"}})
+	}
+{{- end}}
+{{- if $f.Len}}
+	if l := len(a.{{$f.Name}}); {{lenCond $f.Len}} {
+		return errors.New({{errMsg $mod.Module $m.Method $f "length error"}})
+	}
+{{- end}}
+{{- if $f.ItemLen}}
+	for _, v := range a.{{$f.Name}} {
+		if l := len(v); {{lenCond $f.ItemLen}} {
+			return errors.New({{errMsg $mod.Module $m.Method $f "item length error"}})
+		}
+	}
+{{- end}}
+{{- if $f.Min}}
+	if float64(a.{{$f.Name}}) < {{$f.Min}} {
+		return errors.New({{errMsg $mod.Module $m.Method $f (printf "must be >= %v" (num $f.Min))}})
+	}
+{{- end}}
+{{- if $f.Max}}
+	if float64(a.{{$f.Name}}) > {{$f.Max}} {
+		return errors.New({{errMsg $mod.Module $m.Method $f (printf "must be <= %v" (num $f.Max))}})
+	}
+{{- end}}
+{{- if $f.OneOf}}
+	switch a.{{$f.Name}} {
+	case {{quoteAll $f.OneOf}}:
+	default:
+		return errors.New({{errMsg $mod.Module $m.Method $f (printf "must be one of %s" (quoteAll $f.OneOf))}})
+	}
+{{- end}}
+{{- end}}
+	return nil
+}
+{{end}}{{if $m.Sync}}
+func (m {{$mod.Type}}) {{$m.Name}}(args {{$m.ArgsType}}) ({{with $m.ResultType}}{{.}}, {{end}}error) {
+	clusterId, serverId, path := m.Link.Resolve().Parts()
+	{{- if $m.FileField}}
+	args.{{$m.FileField}} = path
+	{{- else}}
+	_ = path
+	{{- end}}
+{{- if eq $m.Result "links"}}
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	var paths []string
+	if err := m.Methods.Call(clusterId, serverId, "{{$mod.Module}}", "{{$m.Method}}", args, &paths); err != nil {
+		return nil, err
+	}
+	return toHfLinks(clusterId, serverId, paths)
+{{- else if $m.ResultType}}
+	var result {{$m.ResultType}}
+	if err := args.Validate(); err != nil {
+		return result, err
+	}
+	err := m.Methods.Call(clusterId, serverId, "{{$mod.Module}}", "{{$m.Method}}", args, &result)
+	return result, err
+{{- else}}
+	if err := args.Validate(); err != nil {
+		return err
+	}
+	return m.Methods.Call(clusterId, serverId, "{{$mod.Module}}", "{{$m.Method}}", args, nil)
+{{- end}}
+}
+{{end}}{{if $m.Async}}
+// {{$m.Name}}Async reports to progressKey, or to a key of its own if progressKey is "".
+func (m {{$mod.Type}}) {{$m.Name}}Async(args {{$m.ArgsType}}, progressKey string) (*Job, error) {
+	clusterId, serverId, path := m.Link.Resolve().Parts()
+	{{- if $m.FileField}}
+	args.{{$m.FileField}} = path
+	{{- else}}
+	_ = path
+	{{- end}}
+	job := m.Methods.newJob(clusterId, serverId, "{{$mod.Module}}", "{{$m.Method}}", progressKey)
+	{{- if $m.ProgressField}}
+	args.{{$m.ProgressField}} = job.ProgressKey
+	{{- end}}
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	return m.Methods.callAsync(job, args)
+}
+{{end}}{{end}}{{end}}`))
+
+func main() {
+	specFile := flag.String("spec", "modules.json", "spec file")
+	out := flag.String("out", "modules_gen.go", "output go file")
+	flag.Parse()
+	if err := run(*specFile, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "hfgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(specFile, out string) error {
+	bs, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		return err
+	}
+	var spec Spec
+	if err = json.Unmarshal(bs, &spec); err != nil {
+		return err
+	}
+	for i := range spec.Modules {
+		mod := &spec.Modules[i]
+		if "" == mod.Module || "" == mod.Type {
+			return fmt.Errorf("module needs module and type: %+v", mod)
+		}
+		for j := range mod.Methods {
+			m := &mod.Methods[j]
+			if "" == m.Method || "" == m.Name {
+				return fmt.Errorf("%s: method needs method and name", mod.Module)
+			}
+			if "" != m.Args && len(m.Fields) > 0 {
+				return fmt.Errorf("%s/%s: args and fields exclude each other", mod.Module, m.Method)
+			}
+			// ImageModule + CropResize -> ImageCropResizeArgs
+			m.ArgsType = m.Args
+			if "" == m.ArgsType {
+				m.ArgsType = strings.TrimSuffix(mod.Type, "Module") + m.Name + "Args"
+			}
+			for _, f := range m.Fields {
+				if err = validate(f); err != nil {
+					return fmt.Errorf("%s/%s: %v", mod.Module, m.Method, err)
+				}
+			}
+		}
+	}
+	needErrors := false
+	for _, mod := range spec.Modules {
+		for _, m := range mod.Methods {
+			for _, f := range m.Fields {
+				needErrors = needErrors || f.checked()
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, map[string]interface{}{"Spec": spec, "Source": filepath.Base(specFile), "NeedErrors": needErrors}); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, buf.Bytes())
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
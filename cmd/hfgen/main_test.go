@@ -0,0 +1,135 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sourceImporter imports the dependencies of the package from source, once for all the tests.
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// typeCheck type checks the generated file gen in place of modules_gen.go, with the extra sources, in package httpfsclient.
+func typeCheck(t *testing.T, gen string, extra ...string) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, "../..", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && "modules_gen.go" != fi.Name()
+	}, 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+	var files []*ast.File
+	for _, f := range pkgs["httpfsclient"].Files {
+		files = append(files, f)
+	}
+	for i, src := range append([]string{gen}, extra...) {
+		f, err := parser.ParseFile(fset, "gen"+string(rune('a'+i))+".go", src, 0)
+		if !assert.Nil(t, err) {
+			return
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: sourceImporter}
+	_, err = conf.Check("github.com/RocksonZeta/httpfsclient", fset, files, nil)
+	assert.Nil(t, err)
+}
+
+// modules_gen.go must be regenerated when modules.json changes
+func TestGeneratedUpToDate(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "modules_gen.go")
+	assert.Nil(t, run("../../modules.json", out))
+	want, _ := ioutil.ReadFile("../../modules_gen.go")
+	got, _ := ioutil.ReadFile(out)
+	assert.Equal(t, string(want), string(got))
+	typeCheck(t, string(got))
+}
+
+func TestChecks(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "spec.json")
+	ioutil.WriteFile(spec, []byte(`{"modules": [{"module": "doc", "type": "DocModule", "methods": [{
+		"method": "render", "name": "Render", "modes": ["sync"], "result": "int", "fields": [
+			{"name": "Format", "type": "string", "json": "format", "required": true, "oneOf": ["png", "jpeg"]},
+			{"name": "Dpi", "type": "int", "min": 36, "max": 600}
+		]}]}]}`), 0644)
+	out := filepath.Join(dir, "gen.go")
+	assert.Nil(t, run(spec, out))
+	bs, _ := ioutil.ReadFile(out)
+	src := string(bs)
+	for _, s := range []string{
+		"type DocRenderArgs struct",
+		"Format string `json:\"format\"`",
+		"case \"png\", \"jpeg\":",
+		"float64(a.Dpi) > 600",
+		"func (m DocModule) Render(args DocRenderArgs) (int, error)",
+	} {
+		assert.True(t, strings.Contains(src, s), s)
+	}
+	assert.False(t, strings.Contains(src, "RenderAsync"))
+	typeCheck(t, src)
+
+	ioutil.WriteFile(spec, []byte(`{"modules": [{"module": "doc", "type": "DocModule", "methods": [{"method": "x", "name": "X", "fields": [{"name": "A"}]}]}]}`), 0644)
+	assert.NotNil(t, run(spec, out))
+	ioutil.WriteFile(spec, []byte(`{"modules": [{"module": "doc", "type": "DocModule", "methods": [{"method": "x", "name": "X", "fields": [{"name": "A", "type": "[]int", "min": 1}]}]}]}`), 0644)
+	assert.NotNil(t, run(spec, out))
+	ioutil.WriteFile(spec, []byte(`{"modules": [{"module": "doc", "type": "DocModule", "methods": [{"method": "x", "name": "X", "args": "XParam", "fields": [{"name": "A", "type": "int"}]}]}]}`), 0644)
+	assert.NotNil(t, run(spec, out))
+	os.Remove(out)
+}
+
+func TestRequired(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "spec.json")
+	ioutil.WriteFile(spec, []byte(`{"modules": [{"module": "doc", "type": "DocModule", "methods": [{
+		"method": "render", "name": "Render", "modes": ["sync"], "fields": [
+			{"name": "Pages", "type": "[]int", "required": true},
+			{"name": "Meta", "type": "map[string]string", "required": true},
+			{"name": "Done", "type": "func()", "required": true},
+			{"name": "Title", "type": "string", "required": true},
+			{"name": "Dpi", "type": "int", "required": true}
+		]}]}]}`), 0644)
+	out := filepath.Join(dir, "gen.go")
+	assert.Nil(t, run(spec, out))
+	bs, _ := ioutil.ReadFile(out)
+	src := string(bs)
+	for _, s := range []string{
+		"if len(a.Pages) == 0 {",
+		"if len(a.Meta) == 0 {",
+		"if a.Done == nil {",
+		"if \"\" == a.Title {",
+		"if a.Dpi == 0 {",
+	} {
+		assert.True(t, strings.Contains(src, s), s)
+	}
+	typeCheck(t, src)
+}
+
+func TestArgsType(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "spec.json")
+	ioutil.WriteFile(spec, []byte(`{"modules": [{"module": "doc", "type": "DocModule", "methods": [{
+		"method": "render", "name": "Render", "fileField": "FilePath", "args": "RenderParam"}]}]}`), 0644)
+	out := filepath.Join(dir, "gen.go")
+	assert.Nil(t, run(spec, out))
+	bs, _ := ioutil.ReadFile(out)
+	src := string(bs)
+	assert.False(t, strings.Contains(src, "type DocRenderArgs"))
+	assert.False(t, strings.Contains(src, "Validate() error"))
+	assert.True(t, strings.Contains(src, "func (m DocModule) Render(args RenderParam) error"))
+	assert.True(t, strings.Contains(src, "func (m DocModule) RenderAsync(args RenderParam, progressKey string) (*Job, error)"))
+	typeCheck(t, src, `package httpfsclient
+
+type RenderParam struct{ FilePath string }
+
+func (p RenderParam) Validate() error { return nil }
+`)
+}
@@ -0,0 +1,108 @@
+package httpfsclient
+
+import (
+	"errors"
+)
+
+// PdfRenderParam is the param of pdf/render: pages From to To, 1-based, are rendered as images.
+type PdfRenderParam struct {
+	FilePath string
+	From     int    // 0 means 1
+	To       int    // 0 means the last page
+	Dpi      int    `json:",omitempty"` // 0 means 150
+	Format   string `json:",omitempty"` // ImageFormat*, default png
+}
+
+func (p PdfRenderParam) Validate() error {
+	if p.From < 0 || p.To < 0 || (p.To != 0 && p.To < p.From) {
+		return errors.New("PdfRender param error. pages must be 1 <= from <= to.")
+	}
+	if p.Dpi != 0 && (p.Dpi < 36 || p.Dpi > 600) {
+		return errors.New("PdfRender param error. dpi must be 36-600.")
+	}
+	if "" != p.Format && p.Format != ImageFormatJpeg && p.Format != ImageFormatPng && p.Format != ImageFormatWebp {
+		return errors.New("PdfRender param error. format must be jpeg, png or webp.")
+	}
+	return nil
+}
+
+type EpubMetadata struct {
+	Title       string
+	Creators    []string `json:",omitempty"`
+	Language    string   `json:",omitempty"`
+	Identifier  string   `json:",omitempty"` // eg. isbn or uuid
+	Publisher   string   `json:",omitempty"`
+	Date        string   `json:",omitempty"`
+	Description string   `json:",omitempty"`
+	Subjects    []string `json:",omitempty"`
+}
+
+// callLink calls a method returning one file path and turns it into a link.
+func (m Methods) callLink(hf HfLink, module, method string, args interface{}) (HfLink, error) {
+	clusterId, serverId, _ := hf.Parts()
+	var resultPath string
+	if err := m.Call(clusterId, serverId, module, method, args, &resultPath); err != nil {
+		return "", err
+	}
+	if "" == resultPath {
+		return "", errors.New(module + "/" + method + " returned no file")
+	}
+	return ParseHfLink(clusterId + ":" + serverId + resultPath)
+}
+
+// OfficeToPdf converts a doc, xls, ppt ... to a pdf in CollectionPdf.
+func (m Methods) OfficeToPdf(hf HfLink) (HfLink, error) {
+	hf = hf.Resolve()
+	return m.callLink(hf, "office", "topdf", FileParam{FilePath: hf.Path()})
+}
+
+// PdfRender renders pages to images in CollectionImage, one link per page.
+func (m Methods) PdfRender(hf HfLink, param PdfRenderParam) ([]HfLink, error) {
+	if err := param.Validate(); err != nil {
+		return nil, err
+	}
+	clusterId, serverId, path := hf.Resolve().Parts()
+	param.FilePath = path
+	var resultPaths []string
+	if err := m.Call(clusterId, serverId, "pdf", "render", param, &resultPaths); err != nil {
+		return nil, err
+	}
+	return toHfLinks(clusterId, serverId, resultPaths)
+}
+
+func (m Methods) PdfPageCount(hf HfLink) (int, error) {
+	clusterId, serverId, path := hf.Resolve().Parts()
+	var count int
+	err := m.Call(clusterId, serverId, "pdf", "pagecount", FileParam{FilePath: path}, &count)
+	return count, err
+}
+
+// EpubCover extracts the cover image to CollectionImage.
+func (m Methods) EpubCover(hf HfLink) (HfLink, error) {
+	hf = hf.Resolve()
+	return m.callLink(hf, "epub", "cover", FileParam{FilePath: hf.Path()})
+}
+
+// EpubMetadata reads the dublin core metadata of the package document.
+func (m Methods) EpubMetadata(hf HfLink) (EpubMetadata, error) {
+	clusterId, serverId, path := hf.Resolve().Parts()
+	var meta EpubMetadata
+	err := m.Call(clusterId, serverId, "epub", "metadata", FileParam{FilePath: path}, &meta)
+	return meta, err
+}
+
+func (d HfLink) OfficeToPdf() (HfLink, error) {
+	return Methods{}.OfficeToPdf(d)
+}
+func (d HfLink) PdfRender(param PdfRenderParam) ([]HfLink, error) {
+	return Methods{}.PdfRender(d, param)
+}
+func (d HfLink) PdfPageCount() (int, error) {
+	return Methods{}.PdfPageCount(d)
+}
+func (d HfLink) EpubCover() (HfLink, error) {
+	return Methods{}.EpubCover(d)
+}
+func (d HfLink) EpubMetadata() (EpubMetadata, error) {
+	return Methods{}.EpubMetadata(d)
+}
@@ -0,0 +1,47 @@
+package httpfsclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/call/office/topdf":
+			assert.Equal(t, `{"FilePath":"/office/00/00/gysz2c6aqf/a.docx"}`, r.FormValue("args"))
+			w.Write([]byte(`{"State":0,"Data":"/pdf/00/00/gysz2c6aqf/a.pdf"}`))
+		case "/call/pdf/render":
+			var p httpfsclient.PdfRenderParam
+			assert.Nil(t, json.Unmarshal([]byte(r.FormValue("args")), &p))
+			assert.Equal(t, httpfsclient.PdfRenderParam{FilePath: "/pdf/00/00/gysz2c6aqf/a.pdf", From: 2, To: 3, Dpi: 72}, p)
+			w.Write([]byte(`{"State":0,"Data":["/image/00/00/gysz2c6aqf/a_2.png","/image/00/00/gysz2c6aqf/a_3.png"]}`))
+		case "/call/pdf/pagecount":
+			w.Write([]byte(`{"State":0,"Data":12}`))
+		case "/call/epub/metadata":
+			w.Write([]byte(`{"State":0,"Data":{"Title":"Go","Creators":["A","B"],"Language":"en"}}`))
+		}
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "docc", ServerId: "s1", Local: ts.URL})
+
+	pdf, err := httpfsclient.HfLink("docc:s1/office/00/00/gysz2c6aqf/a.docx").OfficeToPdf()
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.HfLink("docc:s1/pdf/00/00/gysz2c6aqf/a.pdf"), pdf)
+	pages, err := pdf.PdfRender(httpfsclient.PdfRenderParam{From: 2, To: 3, Dpi: 72})
+	assert.Nil(t, err)
+	assert.Equal(t, []httpfsclient.HfLink{"docc:s1/image/00/00/gysz2c6aqf/a_2.png", "docc:s1/image/00/00/gysz2c6aqf/a_3.png"}, pages)
+	_, err = pdf.PdfRender(httpfsclient.PdfRenderParam{From: 3, To: 2})
+	assert.NotNil(t, err)
+	n, err := pdf.PdfPageCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 12, n)
+	meta, err := httpfsclient.HfLink("docc:s1/epub/00/00/gysz2c6aqf/a.epub").EpubMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.EpubMetadata{Title: "Go", Creators: []string{"A", "B"}, Language: "en"}, meta)
+}
@@ -0,0 +1,246 @@
+package httpfsclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/RocksonZeta/httpfsclient/kv"
+	"github.com/RocksonZeta/httpfsclient/util/imageutil"
+)
+
+// DupIndexKeyPrefix prefixes the redis keys of the DupIndex of a cluster.
+const DupIndexKeyPrefix = "httpfs/imagehash/"
+
+// dupBands is how many 8 bit bands of the hash are indexed. Hashes at a distance < dupBands share a band,
+// so candidates at a distance up to dupBands-1 are always found, farther ones only if they happen to share one.
+const dupBands = 8
+
+// DupCandidate is an indexed image similar to the checked one.
+type DupCandidate struct {
+	Link       HfLink
+	Distance   int
+	Similarity float64
+}
+
+// DupIndex finds near duplicate images by a 64 bit perceptual hash, imageutil.PHash unless HashFunc is set.
+// The hashes live in redis, shared by the clients, or in memory if the clusters are not initialized.
+//
+//	hash, dups, err := index.Check(bytes.NewReader(upload), 0.9)
+//	if len(dups) == 0 {
+//		link, err = httpfsclient.Write(bytes.NewReader(upload), clusterId, name, httpfsclient.CollectionImage)
+//		index.Add(link, hash)
+//	}
+type DupIndex struct {
+	Prefix string
+	// HashFunc hashes the images of AddLink and Check, nil is imageutil.PHash. All the hashes of an index,
+	// also those given to Add and Find, must come from the same function: hashes of different functions do not compare.
+	HashFunc func(image.Image) imageutil.Hash
+
+	mu   sync.Mutex
+	mem  map[string]string          // link -> hash, without redis, made by the first Add
+	sets map[string]map[string]bool // band key -> links, without redis, made by the first Add
+}
+
+func NewDupIndex(clusterId string) *DupIndex {
+	return &DupIndex{Prefix: DupIndexKeyPrefix + clusterId + ":"}
+}
+
+func (x *DupIndex) hashKey() string {
+	return x.Prefix + "hash"
+}
+
+func (x *DupIndex) bandKeys(hash imageutil.Hash) []string {
+	keys := make([]string, dupBands)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%sband:%d:%02x", x.Prefix, i, uint8(hash>>(8*uint(i))))
+	}
+	return keys
+}
+
+// Add indexes the hash of an image.
+func (x *DupIndex) Add(link HfLink, hash imageutil.Hash) error {
+	link = link.Resolve()
+	if err := x.Remove(link); err != nil {
+		return err
+	}
+	if nil == redisFactory {
+		x.mu.Lock()
+		defer x.mu.Unlock()
+		if nil == x.mem {
+			x.mem, x.sets = map[string]string{}, map[string]map[string]bool{}
+		}
+		x.mem[string(link)] = hash.String()
+		for _, key := range x.bandKeys(hash) {
+			if nil == x.sets[key] {
+				x.sets[key] = map[string]bool{}
+			}
+			x.sets[key][string(link)] = true
+		}
+		return nil
+	}
+	redis := redisFactory.Get()
+	defer redis.Close()
+	if err := redis.HSet(x.hashKey(), string(link), hash.String(), 0); err != nil {
+		return err
+	}
+	for _, key := range x.bandKeys(hash) {
+		if err := redis.SAdd(key, string(link)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddLink reads and indexes an image of CollectionImage, eg. to index the files written before the index.
+func (x *DupIndex) AddLink(link HfLink) (imageutil.Hash, error) {
+	if link.Collection() != CollectionImage {
+		return 0, errors.New("not an image:" + string(link))
+	}
+	bs, err := link.Read()
+	if err != nil {
+		return 0, err
+	}
+	hash, err := x.hashReader(bytes.NewReader(bs))
+	if err != nil {
+		return 0, err
+	}
+	return hash, x.Add(link, hash)
+}
+
+func (x *DupIndex) hashReader(r io.Reader) (imageutil.Hash, error) {
+	if nil == x.HashFunc {
+		return imageutil.HashReader(r)
+	}
+	return imageutil.HashReaderWith(r, x.HashFunc)
+}
+
+// Remove drops an image from the index, eg. when the file is deleted.
+func (x *DupIndex) Remove(link HfLink) error {
+	link = link.Resolve()
+	s, err := x.getHash(string(link))
+	if err != nil || "" == s {
+		return err
+	}
+	hash, err := imageutil.ParseHash(s)
+	if err != nil {
+		return err
+	}
+	if nil == redisFactory {
+		x.mu.Lock()
+		defer x.mu.Unlock()
+		delete(x.mem, string(link))
+		for _, key := range x.bandKeys(hash) {
+			delete(x.sets[key], string(link))
+		}
+		return nil
+	}
+	redis := redisFactory.Get()
+	defer redis.Close()
+	for _, key := range x.bandKeys(hash) {
+		if err := redis.SRem(key, string(link)); err != nil {
+			return err
+		}
+	}
+	return redis.HDel(x.hashKey(), string(link))
+}
+
+func (x *DupIndex) getHash(link string) (string, error) {
+	if nil == redisFactory {
+		x.mu.Lock()
+		defer x.mu.Unlock()
+		return x.mem[link], nil
+	}
+	redis := redisFactory.Get()
+	defer redis.Close()
+	var s string
+	err := redis.HGet(x.hashKey(), link, &s)
+	return s, err
+}
+
+// candidates returns the links sharing a band with hash, and their hashes. redis is nil without redis.
+func (x *DupIndex) candidates(redis *kv.Service, hash imageutil.Hash) ([]string, []string, error) {
+	seen := map[string]bool{}
+	var links []string
+	for _, key := range x.bandKeys(hash) {
+		var members []string
+		if nil == redis {
+			x.mu.Lock()
+			for link := range x.sets[key] {
+				members = append(members, link)
+			}
+			x.mu.Unlock()
+		} else {
+			var err error
+			if members, err = redis.SMembers(key); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, link := range members {
+			if !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	if len(links) == 0 {
+		return nil, nil, nil
+	}
+	if nil != redis {
+		var hashes []string
+		err := redis.HMGet(x.hashKey(), &hashes, links...)
+		return links, hashes, err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	hashes := make([]string, len(links))
+	for i, link := range links {
+		hashes[i] = x.mem[link]
+	}
+	return links, hashes, nil
+}
+
+// Find returns the indexed images with a similarity of at least threshold to hash, the most similar first.
+// A threshold of 0.89 or more finds all of them, see dupBands.
+func (x *DupIndex) Find(hash imageutil.Hash, threshold float64) ([]DupCandidate, error) {
+	var redis *kv.Service
+	if nil != redisFactory {
+		redis = redisFactory.Get()
+		defer redis.Close()
+	}
+	links, hashes, err := x.candidates(redis, hash)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []DupCandidate
+	for i, link := range links {
+		other, err := imageutil.ParseHash(hashes[i])
+		if err != nil {
+			continue
+		}
+		if similarity := imageutil.Similarity(hash, other); similarity >= threshold {
+			candidates = append(candidates, DupCandidate{Link: HfLink(link), Distance: imageutil.Distance(hash, other), Similarity: similarity})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Distance != candidates[j].Distance {
+			return candidates[i].Distance < candidates[j].Distance
+		}
+		return candidates[i].Link < candidates[j].Link
+	})
+	return candidates, nil
+}
+
+// Check hashes a new upload and finds its near duplicates, the hash is for Add once the upload is written.
+func (x *DupIndex) Check(r io.Reader, threshold float64) (imageutil.Hash, []DupCandidate, error) {
+	hash, err := x.hashReader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	candidates, err := x.Find(hash, threshold)
+	return hash, candidates, err
+}
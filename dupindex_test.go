@@ -0,0 +1,116 @@
+package httpfsclient_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/RocksonZeta/httpfsclient/util/imageutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(w, h int, dark image.Rectangle) []byte {
+	im := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(255 * x / w)
+			if image.Pt(x*100/w, y*100/h).In(dark) {
+				v = 10
+			}
+			im.SetNRGBA(x, y, color.NRGBA{v, 255 - v, v / 2, 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	png.Encode(buf, im)
+	return buf.Bytes()
+}
+
+func TestDupIndex(t *testing.T) {
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(nil))
+	testDupIndex(t, httpfsclient.NewDupIndex("dupc"))
+	// a DupIndex made without NewDupIndex works too
+	testDupIndex(t, &httpfsclient.DupIndex{Prefix: httpfsclient.DupIndexKeyPrefix + "dupc2:"})
+}
+
+func TestDupIndexRedis(t *testing.T) {
+	mem := newMemRedis()
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(mem.factory()))
+	index := httpfsclient.NewDupIndex("dupc")
+	testDupIndex(t, index)
+
+	link := "dupc:s1/image/00/00/gysz2c6aqf/b.png"
+	hash := imageutil.Hash(0x0102030405060708)
+	assert.Nil(t, index.Add(httpfsclient.HfLink(link), hash))
+	assert.Equal(t, []byte(`"`+hash.String()+`"`), mem.hashes[index.Prefix+"hash"][link])
+	assert.True(t, mem.sets[index.Prefix+"band:0:08"][link])
+	assert.True(t, mem.sets[index.Prefix+"band:7:01"][link])
+
+	// one connection and one HMGET for all the candidates
+	assert.Nil(t, index.Add("dupc:s1/image/00/00/gysz2c6aqf/c.png", hash^1))
+	mem.stats()
+	dups, err := index.Find(hash, 0.9)
+	assert.Nil(t, err)
+	assert.Equal(t, []httpfsclient.DupCandidate{
+		{Link: httpfsclient.HfLink(link), Distance: 0, Similarity: 1},
+		{Link: "dupc:s1/image/00/00/gysz2c6aqf/c.png", Distance: 1, Similarity: 1 - 1.0/64},
+	}, dups)
+	dials, commands := mem.stats()
+	assert.Equal(t, 1, dials)
+	assert.Equal(t, []string{"SMEMBERS", "SMEMBERS", "SMEMBERS", "SMEMBERS", "SMEMBERS", "SMEMBERS", "SMEMBERS", "SMEMBERS", "HMGET"}, commands)
+
+	assert.Nil(t, index.Remove(httpfsclient.HfLink(link)))
+	_, ok := mem.hashes[index.Prefix+"hash"][link]
+	assert.False(t, ok)
+	assert.False(t, mem.sets[index.Prefix+"band:0:08"][link])
+	assert.False(t, mem.sets[index.Prefix+"band:7:01"][link])
+}
+
+func TestDupIndexHashFunc(t *testing.T) {
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(nil))
+	original := testImage(300, 200, image.Rect(10, 10, 40, 50))
+	index := httpfsclient.NewDupIndex("duphashc")
+	index.HashFunc = imageutil.DHash
+	hash, _, err := index.Check(bytes.NewReader(original), 0.9)
+	assert.Nil(t, err)
+	im, _ := png.Decode(bytes.NewReader(original))
+	assert.Equal(t, imageutil.DHash(im), hash)
+}
+
+func testDupIndex(t *testing.T, index *httpfsclient.DupIndex) {
+	original := testImage(300, 200, image.Rect(10, 10, 40, 50))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/fs/read/image/00/00/gysz2c6aqf/a.png", r.URL.Path)
+		w.Write(original)
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "dupc", ServerId: "s1", Local: ts.URL})
+
+	hash, dups, err := index.Check(bytes.NewReader(original), 0.9)
+	assert.Nil(t, err)
+	assert.Empty(t, dups)
+	indexed, err := index.AddLink("dupc:s1/image/00/00/gysz2c6aqf/a.png")
+	assert.Nil(t, err)
+	assert.Equal(t, hash, indexed)
+	_, err = index.AddLink("dupc:s1/txt/00/00/gysz2c6aqf/a.txt")
+	assert.NotNil(t, err)
+
+	_, dups, err = index.Check(bytes.NewReader(testImage(150, 100, image.Rect(10, 10, 40, 50))), 0.9)
+	assert.Nil(t, err)
+	if assert.Len(t, dups, 1) {
+		assert.Equal(t, httpfsclient.HfLink("dupc:s1/image/00/00/gysz2c6aqf/a.png"), dups[0].Link)
+		assert.True(t, dups[0].Similarity >= 0.9)
+	}
+	_, dups, err = index.Check(bytes.NewReader(testImage(300, 200, image.Rect(60, 40, 95, 95))), 0.9)
+	assert.Nil(t, err)
+	assert.Empty(t, dups)
+
+	assert.Nil(t, index.Remove("dupc:s1/image/00/00/gysz2c6aqf/a.png"))
+	_, dups, err = index.Check(bytes.NewReader(original), 0.9)
+	assert.Nil(t, err)
+	assert.Empty(t, dups)
+}
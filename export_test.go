@@ -0,0 +1,11 @@
+package httpfsclient
+
+import "github.com/RocksonZeta/httpfsclient/kv"
+
+// SetRedisFactory lets the tests run the redis paths on a redis of their own, nil runs the memory paths.
+// It returns the factory set before, to be set back when the test ends.
+func SetRedisFactory(factory *kv.ServiceFactory) *kv.ServiceFactory {
+	old := redisFactory
+	redisFactory = factory
+	return old
+}
@@ -0,0 +1,280 @@
+package httpfsclient
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/RocksonZeta/httpfsclient/util/imageutil"
+)
+
+// ops of an image transform pipeline, named as the ops of imageutil.Pipeline
+const (
+	ImageOpCrop      = imageutil.OpCrop
+	ImageOpResize    = imageutil.OpResize
+	ImageOpFit       = imageutil.OpFit
+	ImageOpFill      = imageutil.OpFill
+	ImageOpPad       = imageutil.OpPad
+	ImageOpSmart     = imageutil.OpSmart
+	ImageOpWidth     = imageutil.OpWidth
+	ImageOpHeight    = imageutil.OpHeight
+	ImageOpFilter    = imageutil.OpFilter
+	ImageOpBg        = imageutil.OpBg
+	ImageOpNoUpscale = imageutil.OpNoUp
+	ImageOpRotate    = imageutil.OpRotate
+	ImageOpFlip      = imageutil.OpFlip
+	ImageOpFormat    = imageutil.OpFormat
+	ImageOpQuality   = imageutil.OpQuality
+	ImageOpCompress  = imageutil.OpCompress
+	ImageOpStrip     = imageutil.OpStrip
+	ImageOpWatermark = "watermark" // server only, there is no pipeline op
+)
+
+const (
+	ImageFormatJpeg = "jpeg"
+	ImageFormatPng  = "png"
+	ImageFormatWebp = "webp"
+)
+
+const (
+	FlipHorizontal = "h"
+	FlipVertical   = "v"
+)
+
+// watermark positions
+const (
+	PositionCenter    = "center"
+	PositionNorthWest = "nw"
+	PositionNorthEast = "ne"
+	PositionSouthWest = "sw"
+	PositionSouthEast = "se"
+)
+
+// ImageOp is one step of an image transform pipeline, only the fields of Op are used.
+type ImageOp struct {
+	Op         string
+	Crop       []int           `json:",omitempty"` // crop: [x,y,w,h]
+	Size       []int           `json:",omitempty"` // resize, fit, fill, pad, smart: [w,h]; width: [w,0]; height: [0,h]
+	Filter     string          `json:",omitempty"` // filter: imageutil.Filter*, for the next resizes
+	Background string          `json:",omitempty"` // bg: #rrggbb, the background of the next pads
+	Angle      float64         `json:",omitempty"` // rotate: degrees, counter clockwise
+	Direction  string          `json:",omitempty"` // flip: FlipHorizontal or FlipVertical
+	Format     string          `json:",omitempty"` // format: ImageFormat*
+	Quality    int             `json:",omitempty"` // quality: 1-100, for jpeg and webp
+	Level      int             `json:",omitempty"` // compress: png compression level 0-9
+	Watermark  *ImageWatermark `json:",omitempty"` // watermark
+}
+
+// ImageWatermark is a text or an image drawn over the image.
+type ImageWatermark struct {
+	Text     string  `json:",omitempty"`
+	FontSize int     `json:",omitempty"`
+	Color    string  `json:",omitempty"` // eg. #ffffff
+	Image    HfLink  `json:",omitempty"` // the watermark image, may be on another server
+	Position string  `json:",omitempty"` // Position*, default PositionSouthEast
+	Margin   int     `json:",omitempty"` // pixels from the edges
+	Opacity  float64 `json:",omitempty"` // 0-1, 0 means 1
+}
+
+func (op ImageOp) Validate() error {
+	bad := func(msg string) error { return errors.New("ImageOp " + op.Op + " param error. " + msg) }
+	switch op.Op {
+	case ImageOpCrop:
+		if len(op.Crop) != 4 {
+			return bad("crop must be [x,y,w,h].")
+		}
+	case ImageOpResize:
+		if len(op.Size) != 2 || op.Size[0] < 0 || op.Size[1] < 0 || op.Size[0]+op.Size[1] == 0 {
+			return bad("size must be [w,h], 0 keeps the ratio.")
+		}
+	case ImageOpFit, ImageOpFill, ImageOpPad, ImageOpSmart:
+		if len(op.Size) != 2 || op.Size[0] < 1 || op.Size[1] < 1 {
+			return bad("size must be [w,h].")
+		}
+	case ImageOpWidth:
+		if len(op.Size) != 2 || op.Size[0] < 1 || op.Size[1] != 0 {
+			return bad("size must be [w,0].")
+		}
+	case ImageOpHeight:
+		if len(op.Size) != 2 || op.Size[0] != 0 || op.Size[1] < 1 {
+			return bad("size must be [0,h].")
+		}
+	case ImageOpFilter:
+		if "" == op.Filter || !imageutil.IsFilter(op.Filter) {
+			return bad("unknown filter:" + op.Filter)
+		}
+	case ImageOpBg:
+		if _, err := imageutil.ParseColor(op.Background); err != nil {
+			return bad("background must be #rrggbb.")
+		}
+	case ImageOpNoUpscale:
+	case ImageOpRotate:
+	case ImageOpFlip:
+		if op.Direction != FlipHorizontal && op.Direction != FlipVertical {
+			return bad("direction must be h or v.")
+		}
+	case ImageOpFormat:
+		if op.Format != ImageFormatJpeg && op.Format != ImageFormatPng && op.Format != ImageFormatWebp {
+			return bad("format must be jpeg, png or webp.")
+		}
+	case ImageOpQuality:
+		if op.Quality < 1 || op.Quality > 100 {
+			return bad("quality must be 1-100.")
+		}
+	case ImageOpCompress:
+		if op.Level < 0 || op.Level > 9 {
+			return bad("level must be 0-9.")
+		}
+	case ImageOpStrip:
+	case ImageOpWatermark:
+		w := op.Watermark
+		if nil == w || ("" == w.Text) == ("" == w.Image) {
+			return bad("watermark needs a text or an image.")
+		}
+		if w.Opacity < 0 || w.Opacity > 1 {
+			return bad("opacity must be 0-1.")
+		}
+	default:
+		return errors.New("unknown ImageOp:" + strconv.Quote(op.Op))
+	}
+	return nil
+}
+
+// ImagePipelineParam is the param of image/transform: the ops are applied in order to FilePath, the result is saved as a new file.
+type ImagePipelineParam struct {
+	FilePath string
+	Ops      []ImageOp
+	Target   string `json:",omitempty"` // path of the output instead of a generated one
+}
+
+// ImageTransform applies ops to the image and returns the links of the new files.
+func (m Methods) ImageTransform(hf HfLink, ops ...ImageOp) ([]HfLink, error) {
+	if len(ops) == 0 {
+		return nil, errors.New("ImageTransform needs ops.")
+	}
+	for _, op := range ops {
+		if err := op.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	clusterId, serverId, path := hf.Resolve().Parts()
+	var resultPaths []string
+	err := m.Call(clusterId, serverId, "image", "transform", ImagePipelineParam{FilePath: path, Ops: ops}, &resultPaths)
+	if err != nil {
+		return nil, err
+	}
+	return toHfLinks(clusterId, serverId, resultPaths)
+}
+
+// ImagePipeline runs an imageutil.Pipeline spec, eg. "crop:10,10,100,100|fit:60x60|format:webp|quality:80", on the server.
+// The spec is sent as the ImageOps of the same names, so it runs the same as ImageTransform.Apply.
+func (m Methods) ImagePipeline(hf HfLink, spec string) ([]HfLink, error) {
+	p, err := imageutil.ParsePipeline(spec)
+	if err != nil {
+		return nil, err
+	}
+	return m.ImageTransform(hf, imageOpsOf(p)...)
+}
+
+// imageOpsOf converts the ops of a pipeline to ImageOps.
+func imageOpsOf(p imageutil.Pipeline) []ImageOp {
+	ops := make([]ImageOp, len(p))
+	for i, op := range p {
+		ops[i] = ImageOp{Op: op.Name}
+		n := op.Nums
+		switch op.Name {
+		case imageutil.OpCrop:
+			ops[i].Crop = n
+		case imageutil.OpResize, imageutil.OpFit, imageutil.OpFill, imageutil.OpPad, imageutil.OpSmart:
+			ops[i].Size = n
+		case imageutil.OpWidth:
+			ops[i].Size = []int{n[0], 0}
+		case imageutil.OpHeight:
+			ops[i].Size = []int{0, n[0]}
+		case imageutil.OpFilter:
+			ops[i].Filter = op.Arg
+		case imageutil.OpBg:
+			ops[i].Background = op.Arg
+		case imageutil.OpRotate:
+			ops[i].Angle = float64(n[0])
+		case imageutil.OpFlip:
+			ops[i].Direction = op.Arg
+		case imageutil.OpFormat:
+			ops[i].Format = op.Arg
+		case imageutil.OpQuality:
+			ops[i].Quality = n[0]
+		case imageutil.OpCompress:
+			ops[i].Level = n[0]
+		}
+	}
+	return ops
+}
+
+// ImageRotate rotates by angle degrees counter clockwise.
+func (m Methods) ImageRotate(hf HfLink, angle float64) ([]HfLink, error) {
+	return m.ImageTransform(hf, ImageOp{Op: ImageOpRotate, Angle: angle})
+}
+
+// ImageFlip flips FlipHorizontal or FlipVertical.
+func (m Methods) ImageFlip(hf HfLink, direction string) ([]HfLink, error) {
+	return m.ImageTransform(hf, ImageOp{Op: ImageOpFlip, Direction: direction})
+}
+
+// ImageConvert converts to ImageFormat*, quality 0 keeps the server default.
+func (m Methods) ImageConvert(hf HfLink, format string, quality int) ([]HfLink, error) {
+	ops := []ImageOp{{Op: ImageOpFormat, Format: format}}
+	if quality > 0 {
+		ops = append(ops, ImageOp{Op: ImageOpQuality, Quality: quality})
+	}
+	return m.ImageTransform(hf, ops...)
+}
+
+// ImageQuality re-encodes with quality 1-100.
+func (m Methods) ImageQuality(hf HfLink, quality int) ([]HfLink, error) {
+	return m.ImageTransform(hf, ImageOp{Op: ImageOpQuality, Quality: quality})
+}
+
+// ImageCompress re-encodes a png with compression level 0-9.
+func (m Methods) ImageCompress(hf HfLink, level int) ([]HfLink, error) {
+	return m.ImageTransform(hf, ImageOp{Op: ImageOpCompress, Level: level})
+}
+
+// ImageStripMetadata removes exif, icc and other metadata.
+func (m Methods) ImageStripMetadata(hf HfLink) ([]HfLink, error) {
+	return m.ImageTransform(hf, ImageOp{Op: ImageOpStrip})
+}
+
+// ImageWatermark draws a text or an image watermark.
+func (m Methods) ImageWatermark(hf HfLink, watermark ImageWatermark) ([]HfLink, error) {
+	if "" != watermark.Image {
+		watermark.Image = watermark.Image.Resolve()
+	}
+	return m.ImageTransform(hf, ImageOp{Op: ImageOpWatermark, Watermark: &watermark})
+}
+
+func (d HfLink) ImageTransform(ops ...ImageOp) ([]HfLink, error) {
+	return Methods{}.ImageTransform(d, ops...)
+}
+func (d HfLink) ImagePipeline(spec string) ([]HfLink, error) {
+	return Methods{}.ImagePipeline(d, spec)
+}
+func (d HfLink) ImageRotate(angle float64) ([]HfLink, error) {
+	return Methods{}.ImageRotate(d, angle)
+}
+func (d HfLink) ImageFlip(direction string) ([]HfLink, error) {
+	return Methods{}.ImageFlip(d, direction)
+}
+func (d HfLink) ImageConvert(format string, quality int) ([]HfLink, error) {
+	return Methods{}.ImageConvert(d, format, quality)
+}
+func (d HfLink) ImageQuality(quality int) ([]HfLink, error) {
+	return Methods{}.ImageQuality(d, quality)
+}
+func (d HfLink) ImageCompress(level int) ([]HfLink, error) {
+	return Methods{}.ImageCompress(d, level)
+}
+func (d HfLink) ImageStripMetadata() ([]HfLink, error) {
+	return Methods{}.ImageStripMetadata(d)
+}
+func (d HfLink) ImageWatermark(watermark ImageWatermark) ([]HfLink, error) {
+	return Methods{}.ImageWatermark(d, watermark)
+}
@@ -0,0 +1,98 @@
+package httpfsclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageOps(t *testing.T) {
+	var got httpfsclient.ImagePipelineParam
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/call/image/transform", r.URL.Path)
+		got = httpfsclient.ImagePipelineParam{}
+		assert.Nil(t, json.Unmarshal([]byte(r.FormValue("args")), &got))
+		w.Write([]byte(`{"State":0,"Data":["/image/00/00/gysz2c6aqf/new.webp"]}`))
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "imgc", ServerId: "s1", Local: ts.URL})
+	link := httpfsclient.HfLink("imgc:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg")
+
+	links, err := link.ImageConvert(httpfsclient.ImageFormatWebp, 80)
+	assert.Nil(t, err)
+	assert.Equal(t, []httpfsclient.HfLink{"imgc:s1/image/00/00/gysz2c6aqf/new.webp"}, links)
+	assert.Equal(t, "/image/00/00/gysz2c6aqf/joexrtxyco.jpg", got.FilePath)
+	assert.Equal(t, []httpfsclient.ImageOp{{Op: "format", Format: "webp"}, {Op: "quality", Quality: 80}}, got.Ops)
+
+	_, err = link.ImageWatermark(httpfsclient.ImageWatermark{Text: "(c) me", Position: httpfsclient.PositionSouthEast, Opacity: 0.5})
+	assert.Nil(t, err)
+	assert.Equal(t, "(c) me", got.Ops[0].Watermark.Text)
+
+	_, err = link.ImagePipeline("crop:10,10,100,100|fit:60x60|format:webp|quality:80")
+	assert.Nil(t, err)
+	assert.Equal(t, []httpfsclient.ImageOp{
+		{Op: "crop", Crop: []int{10, 10, 100, 100}},
+		{Op: "fit", Size: []int{60, 60}},
+		{Op: "format", Format: "webp"},
+		{Op: "quality", Quality: 80},
+	}, got.Ops)
+	_, err = link.ImagePipeline("filter:lanczos|bg:#ffffff|noupscale|width:60|height:40|rotate:90|flip:h|compress:9|strip")
+	assert.Nil(t, err)
+	assert.Equal(t, []httpfsclient.ImageOp{
+		{Op: "filter", Filter: "lanczos"},
+		{Op: "bg", Background: "#ffffff"},
+		{Op: "noupscale"},
+		{Op: "width", Size: []int{60, 0}},
+		{Op: "height", Size: []int{0, 40}},
+		{Op: "rotate", Angle: 90},
+		{Op: "flip", Direction: "h"},
+		{Op: "compress", Level: 9},
+		{Op: "strip"},
+	}, got.Ops)
+	_, err = link.ImagePipeline("fit:60")
+	assert.NotNil(t, err)
+
+	for _, op := range []httpfsclient.ImageOp{
+		{Op: "flip", Direction: "x"},
+		{Op: "fit", Size: []int{60, 0}},
+		{Op: "width", Size: []int{0, 60}},
+		{Op: "filter", Filter: "bicubic"},
+		{Op: "bg", Background: "white"},
+		{Op: "format", Format: "gif"},
+		{Op: "quality", Quality: 101},
+		{Op: "compress", Level: 10},
+		{Op: "watermark"},
+		{Op: "watermark", Watermark: &httpfsclient.ImageWatermark{Text: "a", Image: "imgc:s1/image/a/b/c.png"}},
+		{Op: "blur"},
+	} {
+		_, err = link.ImageTransform(op)
+		assert.NotNil(t, err, op.Op)
+	}
+}
+
+func TestImageCropResizeParam(t *testing.T) {
+	var got httpfsclient.ImageTransformParam
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/call/image/cropresize", r.URL.Path)
+		assert.Nil(t, json.Unmarshal([]byte(r.FormValue("args")), &got))
+		w.Write([]byte(`{"State":0,"Data":["/image/00/00/gysz2c6aqf/a_60x60.jpg"]}`))
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "imgc", ServerId: "s2", Local: ts.URL})
+	link := httpfsclient.HfLink("imgc:s2/image/00/00/gysz2c6aqf/a.jpg")
+
+	param := httpfsclient.ImageTransformParam{Resize: [][]int{{60, 60}}, Mode: "pad", Filter: "lanczos", Background: "#ffffff", NoUpscale: true}
+	_, err := link.ImageCropResizeParam(param)
+	assert.Nil(t, err)
+	param.FilePath = "/image/00/00/gysz2c6aqf/a.jpg"
+	assert.Equal(t, param, got)
+
+	for _, bad := range []httpfsclient.ImageTransformParam{{Mode: "zoom"}, {Filter: "bicubic"}, {Background: "white"}, {Crop: []int{1}}} {
+		_, err = link.ImageCropResizeParam(bad)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,162 @@
+package httpfsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient/util/hashutil"
+	"github.com/RocksonZeta/httpfsclient/util/httputil"
+)
+
+const (
+	JobStatePending  = 0
+	JobStateRunning  = 1
+	JobStateDone     = 2
+	JobStateFailed   = 3
+	JobStateCanceled = 4
+)
+
+// JobProgressKeyPrefix prefixes the progress key of jobs whose caller did not choose one.
+const JobProgressKeyPrefix = "httpfs/job/"
+
+// JobPollInterval is how often Job.Wait reads the progress.
+var JobPollInterval = time.Second
+
+// JobProgress is the progress record of an async call, shared with the server.
+// The server keeps it as json under the job's progress key in redis, and updates it while the job runs.
+// A missing key reads as a pending job.
+type JobProgress struct {
+	JobId   string
+	State   int             // JobState*
+	Percent float64         // 0-100
+	Stage   string          `json:",omitempty"` // eg. probe, transcode, upload
+	Fps     float64         `json:",omitempty"`
+	Eta     float64         `json:",omitempty"` // seconds left
+	Error   string          `json:",omitempty"` // set when State is JobStateFailed
+	Result  json.RawMessage `json:",omitempty"` // set when State is JobStateDone, the method's result
+	Ut      int64           // update time, unix milliseconds
+}
+
+func (p JobProgress) Finished() bool {
+	return p.State == JobStateDone || p.State == JobStateFailed || p.State == JobStateCanceled
+}
+
+// ProgressSource reads the progress record kept under a progress key.
+type ProgressSource interface {
+	ReadProgress(progressKey string) (JobProgress, error)
+}
+
+// redisProgress reads the records the server keeps in the redis of the clusters.
+type redisProgress struct{}
+
+func (redisProgress) ReadProgress(progressKey string) (JobProgress, error) {
+	var p JobProgress
+	if nil == redisFactory {
+		return p, errors.New("clusters not initialized, call InitClusters first")
+	}
+	redis := redisFactory.Get()
+	defer redis.Close()
+	err := redis.GetJson(progressKey, &p)
+	return p, err
+}
+
+// Job is the handle of an async call.
+type Job struct {
+	Id                  string
+	ClusterId, ServerId string
+	Module, Method      string
+	ProgressKey         string
+	Source              ProgressSource // nil reads the redis of the clusters
+}
+
+// newJob creates the job of an async call. With an IdempotencyKey the job id, and the progress key if not given,
+// derive from the key, so a retried call watches the progress of the first one.
+func (c Methods) newJob(clusterId, serverId, module, method, progressKey string) *Job {
+	id := hashutil.RandomStr32()
+	if key := c.callKey(module, method); "" != key {
+		id = hashutil.Md5(key)
+	}
+	if "" == progressKey {
+		progressKey = JobProgressKeyPrefix + id
+	}
+	return &Job{Id: id, ClusterId: clusterId, ServerId: serverId, Module: module, Method: method, ProgressKey: progressKey}
+}
+
+// Progress reads the progress record from j.Source.
+func (j *Job) Progress() (JobProgress, error) {
+	source := j.Source
+	if nil == source {
+		source = redisProgress{}
+	}
+	p, err := source.ReadProgress(j.ProgressKey)
+	if "" == p.JobId {
+		p.JobId = j.Id
+	}
+	return p, err
+}
+
+// Wait polls the progress until the job finishes or ctx is done. It returns an error if the job failed or was canceled.
+func (j *Job) Wait(ctx context.Context) (JobProgress, error) {
+	ticker := time.NewTicker(JobPollInterval)
+	defer ticker.Stop()
+	for {
+		p, err := j.Progress()
+		if err != nil {
+			return p, err
+		}
+		if p.Finished() {
+			return p, p.err()
+		}
+		select {
+		case <-ctx.Done():
+			return p, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p JobProgress) err() error {
+	switch p.State {
+	case JobStateFailed:
+		return errors.New("job " + p.JobId + " failed:" + p.Error)
+	case JobStateCanceled:
+		return errors.New("job " + p.JobId + " canceled")
+	}
+	return nil
+}
+
+// Result unmarshals the result of a finished job into out.
+func (j *Job) Result(out interface{}) error {
+	p, err := j.Progress()
+	if err != nil {
+		return err
+	}
+	if !p.Finished() {
+		return errors.New("job " + j.Id + " not finished")
+	}
+	if err = p.err(); err != nil {
+		return err
+	}
+	if nil == out || len(p.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(p.Result, out)
+}
+
+// Cancel asks the server to stop the job, the server then sets the state to JobStateCanceled.
+func (j *Job) Cancel() error {
+	server := GetServer(j.ClusterId, j.ServerId)
+	if "" == server.ClusterId {
+		return errors.New("no such server:" + j.ClusterId + ":" + j.ServerId)
+	}
+	status, bs, err := httputil.HttpPostForm3(server.Local+"/call/cancel", map[string]string{"job": j.Id, "progress": j.ProgressKey}, nil)
+	if err != nil {
+		return err
+	}
+	if status != 200 {
+		return errors.New(string(bs))
+	}
+	return nil
+}
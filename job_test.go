@@ -0,0 +1,150 @@
+package httpfsclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/RocksonZeta/httpfsclient/util/httputil"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubProgress returns its records in turn, then the last one again and again.
+type stubProgress struct {
+	mu      sync.Mutex
+	records []httpfsclient.JobProgress
+	keys    []string
+}
+
+func (s *stubProgress) ReadProgress(progressKey string) (httpfsclient.JobProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, progressKey)
+	p := s.records[0]
+	if len(s.records) > 1 {
+		s.records = s.records[1:]
+	}
+	return p, nil
+}
+
+func TestCallAsync(t *testing.T) {
+	var form map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/call/async/video/Mp4":
+			form = map[string]string{"args": r.FormValue("args"), "job": r.FormValue("job"), "progress": r.FormValue("progress"), "callback": r.FormValue("callback")}
+			w.Write([]byte(`{"State":0}`))
+		default:
+			http.Error(w, "no such method", http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "asyncc", ServerId: "s1", Local: ts.URL})
+
+	job, err := httpfsclient.Methods{CallbackUrl: "http://app.test/done"}.CallAsync("asyncc", "s1", "video", "Mp4", map[string]int{"VideoId": 3})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"args": `{"VideoId":3}`, "job": job.Id, "progress": job.ProgressKey, "callback": "http://app.test/done"}, form)
+	assert.Equal(t, httpfsclient.JobProgressKeyPrefix+job.Id, job.ProgressKey)
+	assert.Equal(t, "video", job.Module)
+	assert.Equal(t, "Mp4", job.Method)
+
+	job, err = httpfsclient.Methods{}.CallAsync("asyncc", "s1", "video", "Mp4", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", form["callback"])
+	assert.Equal(t, job.Id, form["job"])
+
+	_, err = httpfsclient.Methods{}.CallAsync("asyncc", "s1", "video", "nosuch", nil)
+	assert.NotNil(t, err)
+}
+
+func TestCallAsyncIdempotent(t *testing.T) {
+	var keys, jobs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(httputil.HeaderIdempotencyKey))
+		jobs = append(jobs, r.FormValue("job"))
+		w.Write([]byte(`{"State":0}`))
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "idemjobc", ServerId: "s1", Local: ts.URL})
+	m := httpfsclient.Methods{IdempotencyKey: "video-3"}
+
+	// a retry gets the job of the first call
+	first, err := m.CallAsync("idemjobc", "s1", "video", "Mp4", nil)
+	assert.Nil(t, err)
+	retry, err := m.CallAsync("idemjobc", "s1", "video", "Mp4", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, first.Id, retry.Id)
+	assert.Equal(t, first.ProgressKey, retry.ProgressKey)
+	assert.Equal(t, []string{"video-3/video/Mp4", "video-3/video/Mp4"}, keys)
+	assert.Equal(t, []string{first.Id, first.Id}, jobs)
+
+	// another method with the same Methods is another call
+	other, err := m.CallAsync("idemjobc", "s1", "video", "CompressDash", nil)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.Id, other.Id)
+	assert.NotEqual(t, first.ProgressKey, other.ProgressKey)
+	assert.Equal(t, "video-3/video/CompressDash", keys[2])
+}
+
+func TestJobCancel(t *testing.T) {
+	var job, progress string
+	fail := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/call/cancel", r.URL.Path)
+		job, progress = r.FormValue("job"), r.FormValue("progress")
+		if fail {
+			http.Error(w, "no such job", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"State":0}`))
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "cancelc", ServerId: "s1", Local: ts.URL})
+
+	j := &httpfsclient.Job{Id: "j1", ClusterId: "cancelc", ServerId: "s1", ProgressKey: "app/p1"}
+	assert.Nil(t, j.Cancel())
+	assert.Equal(t, "j1", job)
+	assert.Equal(t, "app/p1", progress)
+	fail = true
+	assert.NotNil(t, j.Cancel())
+	assert.NotNil(t, (&httpfsclient.Job{Id: "j1", ClusterId: "nosuch", ServerId: "s1"}).Cancel())
+}
+
+func TestJobWait(t *testing.T) {
+	interval := httpfsclient.JobPollInterval
+	httpfsclient.JobPollInterval = time.Millisecond
+	defer func() { httpfsclient.JobPollInterval = interval }()
+
+	source := &stubProgress{records: []httpfsclient.JobProgress{
+		{},
+		{State: httpfsclient.JobStateRunning, Percent: 50},
+		{State: httpfsclient.JobStateDone, Percent: 100, Result: []byte(`"/video/00/00/gysz2c6aqf/a.mp4"`)},
+	}}
+	job := &httpfsclient.Job{Id: "j1", ProgressKey: "app/p1", Source: source}
+	p, err := job.Wait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.JobStateDone, p.State)
+	assert.Equal(t, "j1", p.JobId)
+	assert.Equal(t, []string{"app/p1", "app/p1", "app/p1"}, source.keys)
+	var path string
+	assert.Nil(t, job.Result(&path))
+	assert.Equal(t, "/video/00/00/gysz2c6aqf/a.mp4", path)
+
+	job.Source = &stubProgress{records: []httpfsclient.JobProgress{{State: httpfsclient.JobStateFailed, Error: "bad input"}}}
+	p, err = job.Wait(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, httpfsclient.JobStateFailed, p.State)
+	assert.NotNil(t, job.Result(nil))
+
+	job.Source = &stubProgress{records: []httpfsclient.JobProgress{{State: httpfsclient.JobStateRunning, Percent: 10}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	p, err = job.Wait(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, httpfsclient.JobStateRunning, p.State)
+	assert.NotNil(t, job.Result(nil))
+}
@@ -323,6 +323,16 @@ func (r *Service) Subscribe(channel string) (*redis.PubSubConn, error) {
 
 }
 
+// PSubscribe subscribes the connection to the channels matching pattern, eg. news.*
+func (r *Service) PSubscribe(pattern string) (*redis.PubSubConn, error) {
+	psc := redis.PubSubConn{Conn: r.Redis}
+	err := psc.PSubscribe(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &psc, nil
+}
+
 // TTL returns the seconds to expire, if the key has expiration and error if action failed.
 // Read more at: https://redis.io/commands/ttl
 func (r *Service) TTL(key string) (seconds int64, hasExpiration bool, found bool) {
@@ -349,6 +359,16 @@ func (r *Service) Expires(seconds int64, keys ...string) error {
 	}
 	return err
 }
+
+// SetNX sets key only if it does not exist, it returns false if the key exists.
+func (r *Service) SetNX(key string, value interface{}, seconds int) (bool, error) {
+	if seconds <= 0 {
+		reply, err := r.Redis.Do("SET", key, value, "NX")
+		return reply != nil, err
+	}
+	reply, err := r.Redis.Do("SET", key, value, "EX", seconds, "NX")
+	return reply != nil, err
+}
 func (r *Service) Exists(key string) (bool, error) {
 	return redis.Bool(r.Redis.Do("EXISTS", key))
 }
@@ -466,3 +486,29 @@ func (r *Service) Delete(key string) error {
 	_, err := r.Redis.Do("DEL", key)
 	return err
 }
+
+// HDel removes fields of a hash.
+func (r *Service) HDel(key string, fields ...string) error {
+	args := redis.Args{}.Add(key).AddFlat(fields)
+	_, err := r.Redis.Do("HDEL", args...)
+	return err
+}
+
+// SAdd adds members to a set.
+func (r *Service) SAdd(key string, members ...string) error {
+	args := redis.Args{}.Add(key).AddFlat(members)
+	_, err := r.Redis.Do("SADD", args...)
+	return err
+}
+
+// SRem removes members from a set.
+func (r *Service) SRem(key string, members ...string) error {
+	args := redis.Args{}.Add(key).AddFlat(members)
+	_, err := r.Redis.Do("SREM", args...)
+	return err
+}
+
+// SMembers returns the members of a set, none if the key does not exist.
+func (r *Service) SMembers(key string) ([]string, error) {
+	return redis.Strings(r.Redis.Do("SMEMBERS", key))
+}
@@ -0,0 +1,171 @@
+package httpfsclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient/util/httputil"
+	"github.com/RocksonZeta/httpfsclient/util/imageutil"
+)
+
+// MediaInfoKeyPrefix prefixes the redis keys of cached ImageInfo and VideoInfo, the key is prefix+kind+":"+link.
+const MediaInfoKeyPrefix = "httpfs/info/"
+
+// MediaInfoTtl is how long infos stay cached, 0 keeps them forever. Files are never rewritten, so infos do not go stale.
+var MediaInfoTtl = 7 * 24 * time.Hour
+
+// mediaExifHead is how much of a jpeg is read for its exif, which is in the first segments and at most 64k.
+const mediaExifHead = 128 << 10
+
+// FileParam is the param of the methods that only need the file.
+type FileParam struct {
+	FilePath string
+}
+
+type ImageInfo struct {
+	Width, Height int
+	Format        string // jpeg, png, webp, gif ...
+	Size          int64
+	Orientation   int        `json:",omitempty"` // exif orientation 1-8, Width and Height are as stored
+	ColorModel    string     `json:",omitempty"` // eg. rgb, rgba, gray, cmyk
+	Frames        int        `json:",omitempty"` // frames of animated images
+	Exif          *ImageExif `json:",omitempty"` // of jpegs, nil if there is none
+}
+
+// ImageExif is the camera, capture time and location of a photo, see imageutil.Exif.
+type ImageExif struct {
+	Make, Model string    `json:",omitempty"`
+	LensModel   string    `json:",omitempty"`
+	Software    string    `json:",omitempty"`
+	Time        time.Time // when taken, zero if unknown
+	HasGps      bool      `json:",omitempty"`
+	Latitude    float64   `json:",omitempty"` // degrees, negative for south
+	Longitude   float64   `json:",omitempty"` // degrees, negative for west
+	Altitude    float64   `json:",omitempty"` // meters
+}
+
+type VideoStream struct {
+	Index    int
+	Type     string // video, audio or subtitle
+	Codec    string
+	Bitrate  int64   `json:",omitempty"`
+	Width    int     `json:",omitempty"`
+	Height   int     `json:",omitempty"`
+	Fps      float64 `json:",omitempty"`
+	Rotation int     `json:",omitempty"`
+	Channels int     `json:",omitempty"`
+	Sample   int     `json:",omitempty"` // audio sample rate
+	Language string  `json:",omitempty"`
+}
+
+type VideoInfo struct {
+	Duration   float64 // seconds
+	Size       int64
+	Bitrate    int64
+	Format     string // container, eg. mp4, webm
+	Width      int
+	Height     int
+	Fps        float64
+	VideoCodec string
+	AudioCodec string `json:",omitempty"`
+	Rotation   int    `json:",omitempty"`
+	Streams    []VideoStream
+}
+
+// ImageInfo reads the image header on the server, and the exif of jpegs from the head of the file.
+// The result is cached in redis if the clusters are initialized.
+func (m Methods) ImageInfo(hf HfLink) (ImageInfo, error) {
+	var info ImageInfo
+	err := m.cachedInfo(hf, "image", &info, func(clusterId, serverId, path string) (bool, error) {
+		if err := m.Call(clusterId, serverId, "image", "info", FileParam{FilePath: path}, &info); err != nil {
+			return false, err
+		}
+		if nil == info.Exif && "jpeg" == info.Format {
+			var ok bool
+			info.Exif, ok = readImageExif(GetServer(clusterId, serverId).Local+"/fs/read"+path, info.Size)
+			return ok, nil
+		}
+		return true, nil
+	})
+	return info, err
+}
+
+// readImageExif reads the exif of a jpeg of size bytes with a range request, nil if it has none.
+// ok is false if the head of the file could not be read whole, the exif is then unknown.
+func readImageExif(url string, size int64) (exif *ImageExif, ok bool) {
+	status, bs, err := httputil.HttpGetRange(url, 0, mediaExifHead, 3)
+	if err != nil || status != http.StatusPartialContent {
+		return nil, false
+	}
+	e, err := imageutil.ReadExif(bytes.NewReader(bs))
+	if err != nil {
+		// a short head may have cut the exif
+		return nil, len(bs) >= mediaExifHead || int64(len(bs)) >= size
+	}
+	return &ImageExif{Make: e.Make, Model: e.Model, LensModel: e.LensModel, Software: e.Software, Time: e.Time,
+		HasGps: e.HasGps, Latitude: e.Latitude, Longitude: e.Longitude, Altitude: e.Altitude}, true
+}
+
+// VideoInfo probes the video on the server, the result is cached in redis if the clusters are initialized.
+func (m Methods) VideoInfo(hf HfLink) (VideoInfo, error) {
+	var info VideoInfo
+	err := m.cachedInfo(hf, "video", &info, func(clusterId, serverId, path string) (bool, error) {
+		return true, m.Call(clusterId, serverId, "video", "info", FileParam{FilePath: path}, &info)
+	})
+	return info, err
+}
+
+func (d HfLink) ImageInfo() (ImageInfo, error) {
+	return Methods{}.ImageInfo(d)
+}
+func (d HfLink) VideoInfo() (VideoInfo, error) {
+	return Methods{}.VideoInfo(d)
+}
+
+// mediaInfoKey is keyed by the resolved link, so the links of an alias share the entry.
+func mediaInfoKey(kind string, hf HfLink) string {
+	return MediaInfoKeyPrefix + kind + ":" + string(hf)
+}
+
+// cachedInfo fetches the info into out unless it is in redis. A redis error only skips the cache.
+// No connection is held over the fetch, and an info the fetch reports incomplete is not cached.
+func (m Methods) cachedInfo(hf HfLink, kind string, out interface{}, fetch func(clusterId, serverId, path string) (complete bool, err error)) error {
+	hf = hf.Resolve()
+	key := mediaInfoKey(kind, hf)
+	factory := redisFactory
+	if nil != factory {
+		redis := factory.Get()
+		var cached json.RawMessage
+		err := redis.GetJson(key, &cached)
+		redis.Close()
+		if err == nil && len(cached) != 0 && nil == json.Unmarshal(cached, out) {
+			return nil
+		}
+	}
+	complete, err := fetch(hf.Parts())
+	if err != nil {
+		return err
+	}
+	if nil != factory && complete {
+		redis := factory.Get()
+		defer redis.Close()
+		redis.SetJson(key, out, int64(MediaInfoTtl/time.Second))
+	}
+	return nil
+}
+
+// ForgetMediaInfo removes the cached infos of the link, eg. after the file is deleted.
+func ForgetMediaInfo(hf HfLink) error {
+	if nil == redisFactory {
+		return nil
+	}
+	redis := redisFactory.Get()
+	defer redis.Close()
+	hf = hf.Resolve()
+	if err := redis.Delete(mediaInfoKey("image", hf)); err != nil {
+		return err
+	}
+	return redis.Delete(mediaInfoKey("video", hf))
+}
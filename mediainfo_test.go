@@ -0,0 +1,141 @@
+package httpfsclient_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// exifJpeg is a jpeg with an exif of one tag, the camera make.
+func exifJpeg(camera string) []byte {
+	value := append([]byte(camera), 0)
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("II*\x00")
+	for _, v := range []interface{}{uint32(8), uint16(1), uint16(0x010F), uint16(2), uint32(len(value)), uint32(26), uint32(0)} {
+		binary.Write(tiff, binary.LittleEndian, v)
+	}
+	tiff.Write(value)
+	var im bytes.Buffer
+	jpeg.Encode(&im, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(2+6+tiff.Len()))
+	out.WriteString("Exif\x00\x00")
+	out.Write(tiff.Bytes())
+	out.Write(im.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestMediaInfo(t *testing.T) {
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(nil))
+	calls := 0
+	photo := exifJpeg("Canon")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/call/image/info":
+			calls++
+			assert.Contains(t, r.FormValue("args"), `"FilePath":"/image/00/00/gysz2c6aqf/joexrtxyco.jpg"`)
+			w.Write([]byte(`{"State":0,"Data":{"Width":8,"Height":8,"Format":"jpeg","Size":1024}}`))
+		case "/call/video/info":
+			calls++
+			assert.Contains(t, r.FormValue("args"), `"FilePath":"/video/00/00/gysz2c6aqf/joexrtxyco.mp4"`)
+			w.Write([]byte(`{"State":0,"Data":{"Duration":12.5,"Width":1280,"Height":720,"Fps":25,"VideoCodec":"h264","Streams":[{"Index":0,"Type":"video","Codec":"h264"}]}}`))
+		case "/fs/read/image/00/00/gysz2c6aqf/joexrtxyco.jpg":
+			http.ServeContent(w, r, "joexrtxyco.jpg", time.Time{}, bytes.NewReader(photo))
+		}
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "infoc", ServerId: "s1", Local: ts.URL})
+	photoLink := httpfsclient.HfLink("infoc:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg")
+	videoLink := httpfsclient.HfLink("infoc:s1/video/00/00/gysz2c6aqf/joexrtxyco.mp4")
+
+	img, err := photoLink.ImageInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.ImageInfo{Width: 8, Height: 8, Format: "jpeg", Size: 1024, Exif: &httpfsclient.ImageExif{Make: "Canon"}}, img)
+	video, err := videoLink.VideoInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, 12.5, video.Duration)
+	assert.Equal(t, "h264", video.Streams[0].Codec)
+	assert.Equal(t, 2, calls)
+}
+
+func TestMediaInfoCache(t *testing.T) {
+	mem := newMemRedis()
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(mem.factory()))
+	calls := 0
+	photo := exifJpeg("Canon")
+	readable := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, 0, mem.opened()) // no connection is held over the remote calls
+		switch r.URL.Path {
+		case "/call/image/info":
+			calls++
+			if strings.Contains(r.FormValue("args"), ".jpg") {
+				fmt.Fprintf(w, `{"State":0,"Data":{"Width":8,"Height":8,"Format":"jpeg","Size":%d}}`, len(photo))
+				return
+			}
+			w.Write([]byte(`{"State":0,"Data":{"Width":640,"Height":360,"Format":"png","Size":1024}}`))
+		case "/fs/read/image/00/00/gysz2c6aqf/joexrtxyco.jpg":
+			if !readable {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			http.ServeContent(w, r, "joexrtxyco.jpg", time.Time{}, bytes.NewReader(photo))
+		}
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "infocachec", ServerId: "s1", Local: ts.URL})
+	link := httpfsclient.HfLink("infocachec:s1/image/00/00/gysz2c6aqf/joexrtxyco.png")
+	want := httpfsclient.ImageInfo{Width: 640, Height: 360, Format: "png", Size: 1024}
+
+	info, err := link.ImageInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, want, info)
+	dials, commands := mem.stats()
+	assert.Equal(t, 2, dials)
+	assert.Equal(t, []string{"GET", "SETEX"}, commands)
+	assert.Equal(t, 0, mem.opened())
+
+	info, err = link.ImageInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, want, info)
+	assert.Equal(t, 1, calls)
+	dials, commands = mem.stats()
+	assert.Equal(t, 1, dials)
+	assert.Equal(t, []string{"GET"}, commands)
+
+	assert.Nil(t, httpfsclient.ForgetMediaInfo(link))
+	info, err = link.ImageInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, want, info)
+	assert.Equal(t, 2, calls)
+
+	// the exif of a jpeg whose head can not be read is unknown, the info is not cached
+	photoLink := httpfsclient.HfLink("infocachec:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg")
+	mem.stats()
+	info, err = photoLink.ImageInfo()
+	assert.Nil(t, err)
+	assert.Nil(t, info.Exif)
+	_, commands = mem.stats()
+	assert.Equal(t, []string{"GET"}, commands)
+	readable = true
+	info, err = photoLink.ImageInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, &httpfsclient.ImageExif{Make: "Canon"}, info.Exif)
+	_, commands = mem.stats()
+	assert.Equal(t, []string{"GET", "SETEX"}, commands)
+	info, err = photoLink.ImageInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, &httpfsclient.ImageExif{Make: "Canon"}, info.Exif)
+	assert.Equal(t, 4, calls)
+}
@@ -0,0 +1,103 @@
+// Code generated by hfgen from modules.json. DO NOT EDIT.
+
+package httpfsclient
+
+import (
+	"errors"
+)
+
+// ImageModule calls the methods of the server module image on the server of Link.
+type ImageModule struct {
+	Link    HfLink
+	Methods Methods
+}
+
+func (d HfLink) ImageModule() ImageModule {
+	return ImageModule{Link: d}
+}
+
+func (m ImageModule) CropResize(args ImageTransformParam) ([]HfLink, error) {
+	clusterId, serverId, path := m.Link.Resolve().Parts()
+	args.FilePath = path
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	var paths []string
+	if err := m.Methods.Call(clusterId, serverId, "image", "cropresize", args, &paths); err != nil {
+		return nil, err
+	}
+	return toHfLinks(clusterId, serverId, paths)
+}
+
+// CropResizeAsync reports to progressKey, or to a key of its own if progressKey is "".
+func (m ImageModule) CropResizeAsync(args ImageTransformParam, progressKey string) (*Job, error) {
+	clusterId, serverId, path := m.Link.Resolve().Parts()
+	args.FilePath = path
+	job := m.Methods.newJob(clusterId, serverId, "image", "cropresize", progressKey)
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	return m.Methods.callAsync(job, args)
+}
+
+// VideoModule calls the methods of the server module video on the server of Link.
+type VideoModule struct {
+	Link    HfLink
+	Methods Methods
+}
+
+func (d HfLink) VideoModule() VideoModule {
+	return VideoModule{Link: d}
+}
+
+// VideoCompressDashArgs are the args of /call/video/CompressDash
+type VideoCompressDashArgs struct {
+	File             string
+	ProgressRedisKey string
+	VideoId          int
+}
+
+func (a VideoCompressDashArgs) Validate() error {
+	if float64(a.VideoId) < 0 {
+		return errors.New("video/CompressDash VideoId must be >= 0")
+	}
+	return nil
+}
+
+// CompressDashAsync reports to progressKey, or to a key of its own if progressKey is "".
+func (m VideoModule) CompressDashAsync(args VideoCompressDashArgs, progressKey string) (*Job, error) {
+	clusterId, serverId, path := m.Link.Resolve().Parts()
+	args.File = path
+	job := m.Methods.newJob(clusterId, serverId, "video", "CompressDash", progressKey)
+	args.ProgressRedisKey = job.ProgressKey
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	return m.Methods.callAsync(job, args)
+}
+
+// VideoMp4Args are the args of /call/video/Mp4
+type VideoMp4Args struct {
+	File             string
+	ProgressRedisKey string
+	VideoId          int
+}
+
+func (a VideoMp4Args) Validate() error {
+	if float64(a.VideoId) < 0 {
+		return errors.New("video/Mp4 VideoId must be >= 0")
+	}
+	return nil
+}
+
+// Mp4Async reports to progressKey, or to a key of its own if progressKey is "".
+func (m VideoModule) Mp4Async(args VideoMp4Args, progressKey string) (*Job, error) {
+	clusterId, serverId, path := m.Link.Resolve().Parts()
+	args.File = path
+	job := m.Methods.newJob(clusterId, serverId, "video", "Mp4", progressKey)
+	args.ProgressRedisKey = job.ProgressKey
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	return m.Methods.callAsync(job, args)
+}
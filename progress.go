@@ -0,0 +1,354 @@
+package httpfsclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient/kv"
+	"github.com/gomodule/redigo/redis"
+)
+
+// ProgressBuffer is the buffer of the channels returned by ProgressSubscriber.
+// When a reader falls behind, the oldest events are dropped.
+var ProgressBuffer = 16
+
+// ProgressReconnectMin and ProgressReconnectMax bound the wait between the reconnects of a ProgressSubscriber,
+// it doubles after each failed one.
+var (
+	ProgressReconnectMin = 100 * time.Millisecond
+	ProgressReconnectMax = 10 * time.Second
+)
+
+// ProgressEvent is a JobProgress published by the server.
+// Besides keeping the record under the progress key, the server PUBLISHes every update on the progress key as channel.
+type ProgressEvent struct {
+	Channel string
+	JobProgress
+}
+
+// ProgressSubscriber receives the progress of many jobs over one redis connection and fans them out to go channels.
+type ProgressSubscriber struct {
+	mu           sync.Mutex
+	redis        *kv.Service
+	psc          *redis.PubSubConn
+	dial         func() *kv.Service // nil: a dropped connection closes the subscriber
+	reconnecting bool
+	reconnected  chan struct{}                   // closed and replaced on each reconnect
+	watchers     map[string][]chan ProgressEvent // channel, or "p:"+pattern => watchers
+	closed       bool
+}
+
+// NewProgressSubscriber subscribes on a connection of the redis of the clusters, a dropped connection is replaced.
+func NewProgressSubscriber() (*ProgressSubscriber, error) {
+	factory := redisFactory
+	if nil == factory {
+		return nil, errors.New("clusters not initialized, call InitClusters first")
+	}
+	return NewProgressSubscriberDial(factory.Get), nil
+}
+
+// NewProgressSubscriberOf subscribes on a connection of the caller, Close closes it.
+// When the connection drops, the subscriber is closed.
+func NewProgressSubscriberOf(redis *kv.Service) *ProgressSubscriber {
+	return &ProgressSubscriber{redis: redis, reconnected: make(chan struct{}), watchers: map[string][]chan ProgressEvent{}}
+}
+
+// NewProgressSubscriberDial subscribes on connections of the caller. When the connection drops,
+// the watchers are kept and dial is called, after ProgressReconnectMin then longer waits, until a new one subscribes.
+func NewProgressSubscriberDial(dial func() *kv.Service) *ProgressSubscriber {
+	s := NewProgressSubscriberOf(dial())
+	s.dial = dial
+	return s
+}
+
+// Watch returns the events of one channel, eg. Job.ProgressKey
+func (s *ProgressSubscriber) Watch(channel string) (<-chan ProgressEvent, error) {
+	return s.watch(channel, false)
+}
+
+// WatchPattern returns the events of all channels matching pattern, eg. httpfs/job/*
+func (s *ProgressSubscriber) WatchPattern(pattern string) (<-chan ProgressEvent, error) {
+	return s.watch(pattern, true)
+}
+
+func (s *ProgressSubscriber) WatchJob(job *Job) (<-chan ProgressEvent, error) {
+	return s.Watch(job.ProgressKey)
+}
+
+func (s *ProgressSubscriber) watch(channel string, pattern bool) (<-chan ProgressEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errors.New("ProgressSubscriber closed")
+	}
+	key := channel
+	if pattern {
+		key = "p:" + channel
+	}
+	if len(s.watchers[key]) == 0 {
+		var err error
+		switch {
+		case s.reconnecting: // subscribed with the others on the new connection
+		case nil != s.psc && pattern:
+			err = s.psc.PSubscribe(channel)
+		case nil != s.psc:
+			err = s.psc.Subscribe(channel)
+		default: // the first subscription starts the receiving, a failed one leaves the subscriber as it was
+			var psc *redis.PubSubConn
+			if pattern {
+				psc, err = s.redis.PSubscribe(channel)
+			} else {
+				psc, err = s.redis.Subscribe(channel)
+			}
+			if err == nil {
+				s.psc = psc
+				go s.receive(psc)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	ch := make(chan ProgressEvent, ProgressBuffer)
+	s.watchers[key] = append(s.watchers[key], ch)
+	return ch, nil
+}
+
+// Unwatch closes ch, the subscription is dropped with its last watcher.
+func (s *ProgressSubscriber) Unwatch(ch <-chan ProgressEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, chs := range s.watchers {
+		for i, c := range chs {
+			if (<-chan ProgressEvent)(c) != ch {
+				continue
+			}
+			close(c)
+			s.watchers[key] = append(chs[:i], chs[i+1:]...)
+			if len(s.watchers[key]) > 0 {
+				return nil
+			}
+			delete(s.watchers, key)
+			if s.reconnecting {
+				return nil
+			}
+			if len(key) > 2 && "p:" == key[:2] {
+				return s.psc.PUnsubscribe(key[2:])
+			}
+			return s.psc.Unsubscribe(key)
+		}
+	}
+	return nil
+}
+
+// Close closes the connection and all watching channels.
+func (s *ProgressSubscriber) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	for _, chs := range s.watchers {
+		for _, c := range chs {
+			close(c)
+		}
+	}
+	s.watchers = nil
+	if nil == s.redis { // reconnecting
+		return nil
+	}
+	return s.redis.Close()
+}
+
+// reconnects returns a channel closed on the next reconnect, the events published meanwhile are lost.
+func (s *ProgressSubscriber) reconnects() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reconnected
+}
+
+func (s *ProgressSubscriber) receive(psc *redis.PubSubConn) {
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			var e ProgressEvent
+			if err := json.Unmarshal(v.Data, &e.JobProgress); err != nil {
+				continue
+			}
+			e.Channel = v.Channel
+			key := v.Channel
+			if "" != v.Pattern {
+				key = "p:" + v.Pattern
+			}
+			s.dispatch(key, e)
+		case error:
+			if psc = s.reconnect(); nil == psc {
+				return
+			}
+		}
+	}
+}
+
+// reconnect replaces the dropped connection and subscribes the new one to what is watched.
+// It returns nil when the subscriber is closed, or when nothing is watched and the next watch subscribes.
+func (s *ProgressSubscriber) reconnect() *redis.PubSubConn {
+	s.mu.Lock()
+	if nil == s.dial || s.closed {
+		s.mu.Unlock()
+		s.Close()
+		return nil
+	}
+	s.redis.Close()
+	s.redis, s.psc, s.reconnecting = nil, nil, true
+	s.mu.Unlock()
+	wait := ProgressReconnectMin
+	for {
+		time.Sleep(wait)
+		if wait *= 2; wait > ProgressReconnectMax {
+			wait = ProgressReconnectMax
+		}
+		conn := s.dial()
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		var psc *redis.PubSubConn
+		var err error
+		for key := range s.watchers {
+			if nil == psc {
+				psc = &redis.PubSubConn{Conn: conn.Redis}
+			}
+			if len(key) > 2 && "p:" == key[:2] {
+				err = psc.PSubscribe(key[2:])
+			} else {
+				err = psc.Subscribe(key)
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.redis, s.psc, s.reconnecting = conn, psc, false
+		close(s.reconnected)
+		s.reconnected = make(chan struct{})
+		s.mu.Unlock()
+		return psc
+	}
+}
+
+func (s *ProgressSubscriber) dispatch(key string, e ProgressEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.watchers[key] {
+		select {
+		case c <- e:
+		default: // reader behind, drop the oldest
+			select {
+			case <-c:
+			default:
+			}
+			select {
+			case c <- e:
+			default:
+			}
+		}
+	}
+}
+
+// WriteSSE writes one Server-Sent Event, data is sent as json.
+func WriteSSE(w io.Writer, id, event string, data interface{}) error {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if "" != id {
+		if _, err = fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, bs)
+	return err
+}
+
+// ProgressSSEHandler relays the progress of the job whose progress key is returned by channel(r) to the browser
+// as Server-Sent Events named "progress". The record stored in source, nil for the redis of the clusters, is sent first
+// and again after the subscriber reconnects, if newer. The stream ends when the job finishes or the subscriber is closed.
+//
+//	const es = new EventSource("/progress?key=...");
+//	es.addEventListener("progress", e => show(JSON.parse(e.data)));
+func ProgressSSEHandler(sub *ProgressSubscriber, source ProgressSource, channel func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := channel(r)
+		if "" == key {
+			http.Error(w, "no progress key", http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		ch, err := sub.Watch(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer sub.Unwatch(ch)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		var ut int64 // of the last event sent
+		send := func(e ProgressEvent) bool {
+			if e.Ut <= ut && ut > 0 {
+				return true
+			}
+			ut = e.Ut
+			if err := WriteSSE(w, strconv.FormatInt(e.Ut, 10), "progress", e); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return !e.Finished()
+		}
+		job := &Job{ProgressKey: key, Source: source}
+		stored := func() bool {
+			if p, err := job.Progress(); err == nil && p.Ut > 0 {
+				return send(ProgressEvent{Channel: key, JobProgress: p})
+			}
+			return true
+		}
+		reconnected := sub.reconnects()
+		if !stored() {
+			return
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-reconnected:
+				reconnected = sub.reconnects()
+				if !stored() {
+					return
+				}
+			case e, ok := <-ch:
+				if !ok || !send(e) {
+					return
+				}
+			}
+		}
+	})
+}
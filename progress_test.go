@@ -0,0 +1,273 @@
+package httpfsclient_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/RocksonZeta/httpfsclient/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+// pubsubConn is a redis connection in subscriber mode, the test pushes the messages.
+type pubsubConn struct {
+	mu       sync.Mutex
+	sent     []string
+	fail     error // returned by Flush
+	receives int
+	replies  chan interface{}
+	once     sync.Once
+}
+
+func newPubsubConn() *pubsubConn {
+	return &pubsubConn{replies: make(chan interface{}, 16)}
+}
+
+func (c *pubsubConn) Close() error {
+	c.once.Do(func() { close(c.replies) })
+	return nil
+}
+func (c *pubsubConn) Err() error { return nil }
+func (c *pubsubConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return nil, errors.New("not in subscriber mode")
+}
+func (c *pubsubConn) Send(cmd string, args ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, arg := range args {
+		cmd += " " + arg.(string)
+	}
+	c.sent = append(c.sent, cmd)
+	return nil
+}
+func (c *pubsubConn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fail
+}
+func (c *pubsubConn) Receive() (interface{}, error) {
+	c.mu.Lock()
+	c.receives++
+	c.mu.Unlock()
+	if v, ok := <-c.replies; ok {
+		return v, nil
+	}
+	return nil, errors.New("closed")
+}
+
+func (c *pubsubConn) publish(pattern, channel string, p httpfsclient.JobProgress) {
+	bs, _ := json.Marshal(p)
+	if "" == pattern {
+		c.replies <- []interface{}{[]byte("message"), []byte(channel), bs}
+		return
+	}
+	c.replies <- []interface{}{[]byte("pmessage"), []byte(pattern), []byte(channel), bs}
+}
+
+func (c *pubsubConn) setFail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fail = err
+}
+
+func (c *pubsubConn) stats() ([]string, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.sent...), c.receives
+}
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, httpfsclient.WriteSSE(&buf, "12", "progress", map[string]int{"Percent": 50}))
+	assert.Nil(t, httpfsclient.WriteSSE(&buf, "", "done", nil))
+	assert.Equal(t, "id: 12\nevent: progress\ndata: {\"Percent\":50}\n\nevent: done\ndata: null\n\n", buf.String())
+	assert.NotNil(t, httpfsclient.WriteSSE(&buf, "", "bad", make(chan int)))
+}
+
+func TestProgressSubscriber(t *testing.T) {
+	conn := newPubsubConn()
+	sub := httpfsclient.NewProgressSubscriberOf(&kv.Service{Redis: conn})
+	defer sub.Close()
+
+	// a failed first subscription starts nothing, the next watch subscribes again
+	conn.setFail(errors.New("connection refused"))
+	_, err := sub.Watch("app/p1")
+	assert.NotNil(t, err)
+	_, err = sub.WatchPattern("app/*")
+	assert.NotNil(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, receives := conn.stats()
+	assert.Equal(t, 0, receives)
+
+	conn.setFail(nil)
+	ch, err := sub.Watch("app/p1")
+	assert.Nil(t, err)
+	all, err := sub.WatchPattern("app/*")
+	assert.Nil(t, err)
+	conn.publish("", "app/p1", httpfsclient.JobProgress{JobId: "j1", State: httpfsclient.JobStateRunning, Percent: 50})
+	conn.publish("app/*", "app/p2", httpfsclient.JobProgress{JobId: "j2", State: httpfsclient.JobStateDone})
+	e := <-ch
+	assert.Equal(t, "app/p1", e.Channel)
+	assert.Equal(t, 50.0, e.Percent)
+	e = <-all
+	assert.Equal(t, "app/p2", e.Channel)
+	assert.True(t, e.Finished())
+
+	assert.Nil(t, sub.Unwatch(ch))
+	_, ok := <-ch
+	assert.False(t, ok)
+	sent, _ := conn.stats()
+	assert.Equal(t, []string{"SUBSCRIBE app/p1", "PSUBSCRIBE app/*", "SUBSCRIBE app/p1", "PSUBSCRIBE app/*", "UNSUBSCRIBE app/p1"}, sent)
+
+	// the connection dropping closes the subscriber and its channels
+	conn.Close()
+	_, ok = <-all
+	assert.False(t, ok)
+	_, err = sub.Watch("app/p3")
+	assert.NotNil(t, err)
+}
+
+func TestProgressSSEHandler(t *testing.T) {
+	conn := newPubsubConn()
+	sub := httpfsclient.NewProgressSubscriberOf(&kv.Service{Redis: conn})
+	defer sub.Close()
+	source := &stubProgress{records: []httpfsclient.JobProgress{{JobId: "j1", State: httpfsclient.JobStateRunning, Percent: 20, Ut: 1}}}
+	ts := httptest.NewServer(httpfsclient.ProgressSSEHandler(sub, source, func(r *http.Request) string {
+		return r.URL.Query().Get("key")
+	}))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/progress")
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.Get(ts.URL + "/progress?key=app/p1")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+	assert.Equal(t, "", res.Header.Get("Connection"))
+	conn.publish("", "app/p1", httpfsclient.JobProgress{JobId: "j1", State: httpfsclient.JobStateRunning, Percent: 20, Ut: 1})
+	conn.publish("", "app/p1", httpfsclient.JobProgress{JobId: "j1", State: httpfsclient.JobStateRunning, Percent: 50, Ut: 2})
+	conn.publish("", "app/p1", httpfsclient.JobProgress{JobId: "j1", State: httpfsclient.JobStateDone, Percent: 100, Ut: 3})
+	bs, err := ioutil.ReadAll(res.Body) // the stream ends with the job, the event of the stored record is not sent twice
+	assert.Nil(t, err)
+	assert.Equal(t, "id: 1\nevent: progress\ndata: {\"Channel\":\"app/p1\",\"JobId\":\"j1\",\"State\":1,\"Percent\":20,\"Ut\":1}\n\n"+
+		"id: 2\nevent: progress\ndata: {\"Channel\":\"app/p1\",\"JobId\":\"j1\",\"State\":1,\"Percent\":50,\"Ut\":2}\n\n"+
+		"id: 3\nevent: progress\ndata: {\"Channel\":\"app/p1\",\"JobId\":\"j1\",\"State\":2,\"Percent\":100,\"Ut\":3}\n\n", string(bs))
+	assert.Equal(t, []string{"app/p1"}, source.keys)
+
+	// the subscription failing is an error response
+	conn.setFail(errors.New("connection refused"))
+	res, err = http.Get(ts.URL + "/progress?key=app/p2")
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+}
+
+// dialer dials pubsubConns, the ones of failing dials fail to subscribe.
+type dialer struct {
+	mu      sync.Mutex
+	conns   []*pubsubConn
+	failing map[int]bool // dial index => fails
+}
+
+func (d *dialer) dial() *kv.Service {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := newPubsubConn()
+	if d.failing[len(d.conns)] {
+		c.setFail(errors.New("connection refused"))
+	}
+	d.conns = append(d.conns, c)
+	return &kv.Service{Redis: c}
+}
+
+func (d *dialer) conn(i int) *pubsubConn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if i < len(d.conns) {
+		return d.conns[i]
+	}
+	return nil
+}
+
+// subscribed waits until the i-th connection sent n commands.
+func (d *dialer) subscribed(t *testing.T, i, n int) *pubsubConn {
+	assert.Eventually(t, func() bool {
+		c := d.conn(i)
+		if nil == c {
+			return false
+		}
+		sent, _ := c.stats()
+		return len(sent) >= n
+	}, time.Second, time.Millisecond)
+	return d.conn(i)
+}
+
+func TestProgressSubscriberReconnect(t *testing.T) {
+	defer func(min time.Duration) { httpfsclient.ProgressReconnectMin = min }(httpfsclient.ProgressReconnectMin)
+	httpfsclient.ProgressReconnectMin = time.Millisecond
+	d := &dialer{failing: map[int]bool{1: true}}
+	sub := httpfsclient.NewProgressSubscriberDial(d.dial)
+	defer sub.Close()
+	ch, err := sub.Watch("app/p1")
+	assert.Nil(t, err)
+	all, err := sub.WatchPattern("app/*")
+	assert.Nil(t, err)
+
+	// the second dial fails to subscribe, the third one subscribes to all that is watched
+	d.conn(0).Close()
+	conn := d.subscribed(t, 2, 2)
+	sent, _ := conn.stats()
+	assert.ElementsMatch(t, []string{"SUBSCRIBE app/p1", "PSUBSCRIBE app/*"}, sent)
+	conn.publish("", "app/p1", httpfsclient.JobProgress{JobId: "j1", Percent: 50})
+	conn.publish("app/*", "app/p2", httpfsclient.JobProgress{JobId: "j2", Percent: 60})
+	assert.Equal(t, 50.0, (<-ch).Percent)
+	assert.Equal(t, 60.0, (<-all).Percent)
+
+	// closed, it does not reconnect
+	sub.Close()
+	_, ok := <-ch
+	assert.False(t, ok)
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, d.conn(3))
+}
+
+func TestProgressSSEHandlerReconnect(t *testing.T) {
+	defer func(min time.Duration) { httpfsclient.ProgressReconnectMin = min }(httpfsclient.ProgressReconnectMin)
+	httpfsclient.ProgressReconnectMin = time.Millisecond
+	d := &dialer{}
+	sub := httpfsclient.NewProgressSubscriberDial(d.dial)
+	defer sub.Close()
+	// the job finishes while the subscriber reconnects, the record read after the reconnect ends the stream
+	source := &stubProgress{records: []httpfsclient.JobProgress{
+		{JobId: "j1", State: httpfsclient.JobStateRunning, Percent: 20, Ut: 1},
+		{JobId: "j1", State: httpfsclient.JobStateDone, Percent: 100, Ut: 3},
+	}}
+	ts := httptest.NewServer(httpfsclient.ProgressSSEHandler(sub, source, func(r *http.Request) string {
+		return r.URL.Query().Get("key")
+	}))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/progress?key=app/p1")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	first := make([]byte, len("id: 1\n"))
+	_, err = io.ReadFull(res.Body, first)
+	assert.Nil(t, err)
+	d.subscribed(t, 0, 1).Close()
+	bs, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "event: progress\ndata: {\"Channel\":\"app/p1\",\"JobId\":\"j1\",\"State\":1,\"Percent\":20,\"Ut\":1}\n\n"+
+		"id: 3\nevent: progress\ndata: {\"Channel\":\"app/p1\",\"JobId\":\"j1\",\"State\":2,\"Percent\":100,\"Ut\":3}\n\n", string(bs))
+}
@@ -0,0 +1,157 @@
+package httpfsclient_test
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/RocksonZeta/httpfsclient/kv"
+	"github.com/gomodule/redigo/redis"
+)
+
+// memRedis is an in memory redis with the commands the client uses, each Get of its factory dials a connection.
+type memRedis struct {
+	mu       sync.Mutex
+	strings  map[string][]byte
+	hashes   map[string]map[string][]byte
+	sets     map[string]map[string]bool
+	dials    int
+	open     int // connections dialed and not closed
+	commands []string
+}
+
+func newMemRedis() *memRedis {
+	return &memRedis{strings: map[string][]byte{}, hashes: map[string]map[string][]byte{}, sets: map[string]map[string]bool{}}
+}
+
+func (m *memRedis) factory() *kv.ServiceFactory {
+	return &kv.ServiceFactory{Pool: &redis.Pool{Dial: func() (redis.Conn, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.dials++
+		m.open++
+		return memConn{m}, nil
+	}}}
+}
+
+// stats returns the dials and the commands since the last stats.
+func (m *memRedis) stats() (int, []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dials, commands := m.dials, m.commands
+	m.dials, m.commands = 0, nil
+	return dials, commands
+}
+
+// opened returns the connections open.
+func (m *memRedis) opened() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.open
+}
+
+type memConn struct{ m *memRedis }
+
+func (c memConn) Close() error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	c.m.open--
+	return nil
+}
+func (c memConn) Err() error                        { return nil }
+func (c memConn) Send(string, ...interface{}) error { return errors.New("memRedis: no pipelining") }
+func (c memConn) Flush() error                      { return nil }
+func (c memConn) Receive() (interface{}, error)     { return nil, errors.New("memRedis: no pipelining") }
+func (c memConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	m := c.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if "" == cmd {
+		return nil, nil
+	}
+	m.commands = append(m.commands, cmd)
+	ss := make([]string, len(args))
+	for i, arg := range args {
+		if bs, ok := arg.([]byte); ok {
+			ss[i] = string(bs)
+		} else {
+			ss[i] = fmt.Sprint(arg)
+		}
+	}
+	switch cmd {
+	case "GET":
+		if v, ok := m.strings[ss[0]]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "SET", "SETEX":
+		key, value := ss[0], ss[len(ss)-1]
+		if "SETEX" == cmd {
+			value = ss[2]
+		} else if len(ss) > 2 {
+			value = ss[1]
+			if _, ok := m.strings[key]; ok && "NX" == ss[len(ss)-1] {
+				return nil, nil
+			}
+		}
+		m.strings[key] = []byte(value)
+		return "OK", nil
+	case "DEL":
+		delete(m.strings, ss[0])
+		delete(m.hashes, ss[0])
+		delete(m.sets, ss[0])
+		return int64(1), nil
+	case "HSET":
+		if nil == m.hashes[ss[0]] {
+			m.hashes[ss[0]] = map[string][]byte{}
+		}
+		m.hashes[ss[0]][ss[1]] = []byte(ss[2])
+		return int64(1), nil
+	case "HGET":
+		if v, ok := m.hashes[ss[0]][ss[1]]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "HMGET":
+		vs := make([]interface{}, len(ss)-1)
+		for i, f := range ss[1:] {
+			if v, ok := m.hashes[ss[0]][f]; ok {
+				vs[i] = v
+			}
+		}
+		return vs, nil
+	case "HDEL":
+		for _, f := range ss[1:] {
+			delete(m.hashes[ss[0]], f)
+		}
+		return int64(1), nil
+	case "SADD":
+		if nil == m.sets[ss[0]] {
+			m.sets[ss[0]] = map[string]bool{}
+		}
+		for _, v := range ss[1:] {
+			m.sets[ss[0]][v] = true
+		}
+		return int64(1), nil
+	case "SREM":
+		for _, v := range ss[1:] {
+			delete(m.sets[ss[0]], v)
+		}
+		return int64(1), nil
+	case "SMEMBERS":
+		var members []string
+		for v := range m.sets[ss[0]] {
+			members = append(members, v)
+		}
+		sort.Strings(members)
+		vs := make([]interface{}, len(members))
+		for i, v := range members {
+			vs[i] = []byte(v)
+		}
+		return vs, nil
+	case "EXPIRE":
+		return int64(1), nil
+	}
+	return nil, errors.New("memRedis: unknown command " + cmd)
+}
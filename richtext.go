@@ -0,0 +1,177 @@
+package httpfsclient
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// LinkExpander makes the url to render for a link.
+type LinkExpander func(d HfLink) (string, error)
+
+// PublicUrl expands links to HfLink.Url()
+func PublicUrl(d HfLink) (string, error) {
+	return d.Url(), nil
+}
+
+// SignedUrls expands links to HfLink.SignedUrl(ttl, opts)
+func SignedUrls(ttl time.Duration, opts SignOptions) LinkExpander {
+	return func(d HfLink) (string, error) {
+		return d.SignedUrl(ttl, opts)
+	}
+}
+
+// attributes holding urls
+var htmlUrlAttrs = map[string]bool{"src": true, "href": true, "poster": true, "data": true, "data-src": true, "srcset": true, "style": true}
+
+// urlToken matches the words of a text that may be an url or a link.
+var urlToken = regexp.MustCompile("[^\\s()<>\\[\\]\"'`,]+")
+
+// rewriteTokens rewrites every word of s with fn, trailing punctuation is kept out of the word.
+func rewriteTokens(s string, fn func(string) (string, error)) (string, error) {
+	var err error
+	r := urlToken.ReplaceAllStringFunc(s, func(tok string) string {
+		word := strings.TrimRight(tok, ".;:!?")
+		v, e := fn(word)
+		if e != nil {
+			err = e
+			return tok
+		}
+		return v + tok[len(word):]
+	})
+	return r, err
+}
+
+// toHfLink replaces urls of known servers with their links, other words are kept.
+func toHfLink(s string) (string, error) {
+	if !strings.Contains(s, "://") {
+		return s, nil
+	}
+	if d, ok := FromUrl(s); ok {
+		return string(d), nil
+	}
+	return s, nil
+}
+
+// toUrl replaces links of known clusters with expand(link), other words are kept.
+func toUrl(expand LinkExpander) func(string) (string, error) {
+	return func(s string) (string, error) {
+		d, err := ParseHfLink(s)
+		if err != nil {
+			return s, nil
+		}
+		clusterId, _, _ := d.Parts()
+		if _, ok := GetClusters().GetCluster(clusterId); !ok {
+			return s, nil
+		}
+		return expand(d)
+	}
+}
+
+// rewriteHtml rewrites the url attributes of every tag, everything else is copied as is.
+func rewriteHtml(src string, fn func(string) (string, error)) (string, error) {
+	z := html.NewTokenizer(strings.NewReader(src))
+	var out bytes.Buffer
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return out.String(), nil
+			}
+			return "", z.Err()
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(raw)
+			continue
+		}
+		tok := z.Token()
+		changed := false
+		for i, a := range tok.Attr {
+			if !htmlUrlAttrs[a.Key] || "" != a.Namespace {
+				continue
+			}
+			v, err := rewriteTokens(a.Val, fn)
+			if err != nil {
+				return "", err
+			}
+			if v != a.Val {
+				tok.Attr[i].Val = v
+				changed = true
+			}
+		}
+		if changed {
+			out.WriteString(tok.String())
+		} else {
+			out.Write(raw)
+		}
+	}
+}
+
+// HtmlToHfLinks replaces the urls of known servers in src, srcset, href, poster, style... with their links. Used on save.
+func HtmlToHfLinks(src string) (string, error) {
+	return rewriteHtml(src, toHfLink)
+}
+
+// HtmlToUrls replaces the links in url attributes with expand(link). Used on render.
+func HtmlToUrls(src string, expand LinkExpander) (string, error) {
+	return rewriteHtml(src, toUrl(expand))
+}
+
+var (
+	mdFence    = regexp.MustCompile("^ {0,3}(```|~~~)")
+	mdCodeSpan = regexp.MustCompile("`+[^`]*`+")
+)
+
+// rewriteMarkdown rewrites the words of markdown outside of code blocks and code spans,
+// so link destinations, reference definitions, autolinks, inline html and bare urls are all covered.
+func rewriteMarkdown(src string, fn func(string) (string, error)) (string, error) {
+	lines := strings.SplitAfter(src, "\n")
+	var out strings.Builder
+	fence := ""
+	for _, line := range lines {
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			if "" == fence {
+				fence = m[1]
+			} else if m[1] == fence {
+				fence = ""
+			}
+			out.WriteString(line)
+			continue
+		}
+		if "" != fence || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+			out.WriteString(line)
+			continue
+		}
+		last := 0
+		for _, span := range mdCodeSpan.FindAllStringIndex(line, -1) {
+			s, err := rewriteTokens(line[last:span[0]], fn)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(s)
+			out.WriteString(line[span[0]:span[1]])
+			last = span[1]
+		}
+		s, err := rewriteTokens(line[last:], fn)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(s)
+	}
+	return out.String(), nil
+}
+
+// MarkdownToHfLinks replaces the urls of known servers with their links. Used on save.
+func MarkdownToHfLinks(src string) (string, error) {
+	return rewriteMarkdown(src, toHfLink)
+}
+
+// MarkdownToUrls replaces the links with expand(link). Used on render.
+func MarkdownToUrls(src string, expand LinkExpander) (string, error) {
+	return rewriteMarkdown(src, toUrl(expand))
+}
@@ -0,0 +1,45 @@
+package httpfsclient_test
+
+import (
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRichTextHtml(t *testing.T) {
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "rtc", ServerId: "s1", Proxy: "http://rt.test"})
+	img := "rtc:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg"
+	src := `<p class="a">see <img src="http://rt.test/image/00/00/gysz2c6aqf/joexrtxyco.jpg?w=60&amp;h=60" alt="x"></p>` +
+		`<img srcset="http://rt.test/image/00/00/gysz2c6aqf/joexrtxyco.jpg 1x, http://other.test/a.jpg 2x">` +
+		`<a href="http://other.test/a.jpg">http://rt.test/image/00/00/gysz2c6aqf/joexrtxyco.jpg</a><script>var a = "<b>";</script>`
+	saved, err := httpfsclient.HtmlToHfLinks(src)
+	assert.Nil(t, err)
+	assert.Equal(t, `<p class="a">see <img src="`+img+`" alt="x"></p>`+
+		`<img srcset="`+img+` 1x, http://other.test/a.jpg 2x">`+
+		`<a href="http://other.test/a.jpg">http://rt.test/image/00/00/gysz2c6aqf/joexrtxyco.jpg</a><script>var a = "<b>";</script>`, saved)
+
+	rendered, err := httpfsclient.HtmlToUrls(saved+`<a href="nosuch:s1/a/b">x</a>`, httpfsclient.PublicUrl)
+	assert.Nil(t, err)
+	assert.Equal(t, `<p class="a">see <img src="http://rt.test/image/00/00/gysz2c6aqf/joexrtxyco.jpg" alt="x"></p>`+
+		`<img srcset="http://rt.test/image/00/00/gysz2c6aqf/joexrtxyco.jpg 1x, http://other.test/a.jpg 2x">`+
+		`<a href="http://other.test/a.jpg">http://rt.test/image/00/00/gysz2c6aqf/joexrtxyco.jpg</a><script>var a = "<b>";</script>`+
+		`<a href="nosuch:s1/a/b">x</a>`, rendered)
+}
+
+func TestRichTextMarkdown(t *testing.T) {
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "rtc", ServerId: "s1", Proxy: "http://rt.test"})
+	url := "http://rt.test/image/00/00/gysz2c6aqf/joexrtxyco.jpg"
+	img := "rtc:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg"
+	src := "# title\n![a](" + url + "?x=1 \"t\") and <" + url + ">, see " + url + ".\n" +
+		"[ref]: " + url + "\n`" + url + "` [b](http://other.test/b.jpg)\n```\n" + url + "\n```\n"
+	saved, err := httpfsclient.MarkdownToHfLinks(src)
+	assert.Nil(t, err)
+	assert.Equal(t, "# title\n![a]("+img+" \"t\") and <"+img+">, see "+img+".\n"+
+		"[ref]: "+img+"\n`"+url+"` [b](http://other.test/b.jpg)\n```\n"+url+"\n```\n", saved)
+
+	rendered, err := httpfsclient.MarkdownToUrls(saved, httpfsclient.PublicUrl)
+	assert.Nil(t, err)
+	assert.Equal(t, "# title\n![a]("+url+" \"t\") and <"+url+">, see "+url+".\n"+
+		"[ref]: "+url+"\n`"+url+"` [b](http://other.test/b.jpg)\n```\n"+url+"\n```\n", rendered)
+}
@@ -0,0 +1,157 @@
+package httpfsclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// query params appended by SignedUrl
+const (
+	SignParamExpires   = "e"
+	SignParamKeyId     = "k"
+	SignParamSignature = "s"
+)
+
+var (
+	ErrSignatureMissing = errors.New("url signature missing")
+	ErrSignatureExpired = errors.New("url signature expired")
+	ErrSignatureInvalid = errors.New("url signature invalid")
+	ErrSignKeyUnknown   = errors.New("url sign key unknown")
+)
+
+var signKeys sync.Map // clusterId => []SignKey
+
+// SignKey is a secret used to sign urls. Id is sent with the signature, so secrets can be rotated.
+type SignKey struct {
+	Id     string
+	Secret string
+}
+
+type SignOptions struct {
+	KeyId string    // sign with this key instead of the active one
+	Now   time.Time // zero means time.Now()
+}
+
+// SetSignKeys sets the sign keys of a cluster. The first key signs new urls, all keys are accepted by the verifier.
+// To rotate: SetSignKeys(c, newKey, oldKey), then SetSignKeys(c, newKey) once old urls have expired.
+func SetSignKeys(clusterId string, keys ...SignKey) {
+	ks := make([]SignKey, len(keys))
+	copy(ks, keys)
+	signKeys.Store(clusterId, ks)
+}
+
+func GetSignKeys(clusterId string) []SignKey {
+	if v, ok := signKeys.Load(clusterId); ok {
+		return v.([]SignKey)
+	}
+	return nil
+}
+
+func findSignKey(keys []SignKey, id string) (SignKey, bool) {
+	for _, k := range keys {
+		if k.Id == id {
+			return k, true
+		}
+	}
+	return SignKey{}, false
+}
+
+// SignedUrl returns Url() with an expiry and a signature, eg. http://xxx/image/1.jpg?e=1555555555&k=k1&s=xxx
+func (d HfLink) SignedUrl(ttl time.Duration, opts SignOptions) (string, error) {
+	clusterId, serverId, _ := d.Resolve().Parts()
+	if "" == GetServer(clusterId, serverId).ClusterId {
+		return "", errors.New("no such server:" + string(d))
+	}
+	keys := GetSignKeys(clusterId)
+	if len(keys) == 0 {
+		return "", errors.New("no sign key for cluster:" + clusterId)
+	}
+	key := keys[0]
+	if "" != opts.KeyId {
+		var ok bool
+		if key, ok = findSignKey(keys, opts.KeyId); !ok {
+			return "", errors.New("no such sign key:" + opts.KeyId)
+		}
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return SignUrl(d.Url(), key, now.Add(ttl))
+}
+
+// SignUrl signs the path and the query of rawUrl with key, the url is valid until expires.
+func SignUrl(rawUrl string, key SignKey, expires time.Time) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Del(SignParamSignature)
+	q.Set(SignParamExpires, strconv.FormatInt(expires.Unix(), 10))
+	q.Set(SignParamKeyId, key.Id)
+	q.Set(SignParamSignature, signature(key.Secret, u.EscapedPath(), q))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// signature = base64url(hmac-sha256(secret, escapedPath + "?" + sorted query without s))
+func signature(secret, escapedPath string, q url.Values) string {
+	unsigned := url.Values{}
+	for k, v := range q {
+		if k != SignParamSignature {
+			unsigned[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(escapedPath + "?" + unsigned.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyUrlSignature checks a url made by SignUrl against keys.
+func VerifyUrlSignature(keys []SignKey, u *url.URL, now time.Time) error {
+	q := u.Query()
+	sig := q.Get(SignParamSignature)
+	if "" == sig {
+		return ErrSignatureMissing
+	}
+	expires, err := strconv.ParseInt(q.Get(SignParamExpires), 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	key, ok := findSignKey(keys, q.Get(SignParamKeyId))
+	if !ok {
+		return ErrSignKeyUnknown
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(key.Secret, u.EscapedPath(), q))) {
+		return ErrSignatureInvalid
+	}
+	if now.Unix() > expires {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// VerifySignedUrl checks a url made by HfLink.SignedUrl with the keys of the cluster.
+func VerifySignedUrl(clusterId string, u *url.URL) error {
+	return VerifyUrlSignature(GetSignKeys(clusterId), u, time.Now())
+}
+
+// SignedUrlHandler serves the request by next only if the url is signed by one of the cluster's keys, or responds 403.
+// Keys are looked up on every request, so SetSignKeys takes effect immediately.
+func SignedUrlHandler(clusterId string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifySignedUrl(clusterId, r.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
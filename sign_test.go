@@ -0,0 +1,60 @@
+package httpfsclient_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedUrl(t *testing.T) {
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "signc", ServerId: "s1", Proxy: "http://static.test"})
+	httpfsclient.SetSignKeys("signc", httpfsclient.SignKey{Id: "k1", Secret: "secret1"})
+	link := httpfsclient.HfLink("signc:s1/video/00/00/yyfoatapk5/bdu9kjosiq.mp4")
+	now := time.Now()
+
+	signed, err := link.SignedUrl(time.Hour, httpfsclient.SignOptions{})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(signed, link.Url()+"?"))
+	u, _ := url.Parse(signed)
+	assert.Nil(t, httpfsclient.VerifySignedUrl("signc", u))
+	assert.Equal(t, httpfsclient.ErrSignatureExpired, httpfsclient.VerifyUrlSignature(httpfsclient.GetSignKeys("signc"), u, now.Add(2*time.Hour)))
+
+	tampered, _ := url.Parse(strings.Replace(signed, "bdu9kjosiq", "other00000", 1))
+	assert.Equal(t, httpfsclient.ErrSignatureInvalid, httpfsclient.VerifySignedUrl("signc", tampered))
+	unsigned, _ := url.Parse(link.Url())
+	assert.Equal(t, httpfsclient.ErrSignatureMissing, httpfsclient.VerifySignedUrl("signc", unsigned))
+
+	// rotate: new key signs, old urls still verify until k1 is dropped
+	httpfsclient.SetSignKeys("signc", httpfsclient.SignKey{Id: "k2", Secret: "secret2"}, httpfsclient.SignKey{Id: "k1", Secret: "secret1"})
+	assert.Nil(t, httpfsclient.VerifySignedUrl("signc", u))
+	signed2, _ := link.SignedUrl(time.Hour, httpfsclient.SignOptions{})
+	assert.Contains(t, signed2, "k=k2")
+	httpfsclient.SetSignKeys("signc", httpfsclient.SignKey{Id: "k2", Secret: "secret2"})
+	assert.Equal(t, httpfsclient.ErrSignKeyUnknown, httpfsclient.VerifySignedUrl("signc", u))
+
+	_, err = httpfsclient.HfLink("nosuch:s1/a.txt").SignedUrl(time.Hour, httpfsclient.SignOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestSignedUrlHandler(t *testing.T) {
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "signh", ServerId: "s1", Proxy: "http://static.test"})
+	httpfsclient.SetSignKeys("signh", httpfsclient.SignKey{Id: "k1", Secret: "secret1"})
+	h := httpfsclient.SignedUrlHandler("signh", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	signed, err := httpfsclient.HfLink("signh:s1/image/00/00/a/b.jpg").SignedUrl(time.Minute, httpfsclient.SignOptions{})
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", signed, nil))
+	assert.Equal(t, 200, w.Code)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://static.test/image/00/00/a/b.jpg", nil))
+	assert.Equal(t, 403, w.Code)
+}
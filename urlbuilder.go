@@ -0,0 +1,219 @@
+package httpfsclient
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// UrlBuilder builds the public url of a stored file, and inverts it for FromUrl.
+type UrlBuilder interface {
+	BuildUrl(server Server, path string) string
+	// ParseUrl returns the path of u if u was built by BuildUrl for server.
+	ParseUrl(server Server, u *url.URL) (path string, ok bool)
+}
+
+var urlBuilders = struct {
+	sync.RWMutex
+	m map[string]map[string]UrlBuilder // clusterId => collection ("" for all) => UrlBuilder
+}{m: map[string]map[string]UrlBuilder{}}
+
+// SetUrlBuilder sets the url builder of a cluster, or of one collection of a cluster. nil removes it.
+// The FromUrl patterns of a TemplateUrlBuilder are compiled here for the known servers of the cluster,
+// for a server added later on its first FromUrl.
+func SetUrlBuilder(clusterId, collection string, b UrlBuilder) {
+	urlBuilders.Lock()
+	if nil == b {
+		delete(urlBuilders.m[clusterId], collection)
+		urlBuilders.Unlock()
+		return
+	}
+	if nil == urlBuilders.m[clusterId] {
+		urlBuilders.m[clusterId] = map[string]UrlBuilder{}
+	}
+	urlBuilders.m[clusterId][collection] = b
+	urlBuilders.Unlock()
+	if t, ok := b.(TemplateUrlBuilder); ok {
+		if cluster, ok := GetClusters().GetCluster(clusterId); ok {
+			for _, server := range cluster.Servers() {
+				t.pattern(server)
+			}
+		}
+	}
+}
+
+// GetUrlBuilder returns the builder of the collection, else of the cluster, else ProxyUrlBuilder.
+func GetUrlBuilder(clusterId, collection string) UrlBuilder {
+	urlBuilders.RLock()
+	defer urlBuilders.RUnlock()
+	if b, ok := urlBuilders.m[clusterId][collection]; ok {
+		return b
+	}
+	if b, ok := urlBuilders.m[clusterId][""]; ok {
+		return b
+	}
+	return ProxyUrlBuilder{}
+}
+
+// fromBuiltUrl inverts the url with the builders of every cluster. An url built for several clusters,
+// or for several servers of a cluster, can not be told apart and is not inverted.
+func fromBuiltUrl(rawUrl string) (HfLink, bool) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || !u.IsAbs() {
+		return "", false
+	}
+	var result HfLink
+	found := false
+	urlBuilders.RLock()
+	defer urlBuilders.RUnlock()
+	for _, cluster := range GetClusters().All() {
+		d, ok := fromClusterUrl(cluster.Servers(), urlBuilders.m[cluster.Id], u)
+		if !ok {
+			continue
+		}
+		if found {
+			return "", false
+		}
+		result, found = d, true
+	}
+	return result, found
+}
+
+// fromClusterUrl inverts the url with the collection builders of a cluster, then its own builder, then ProxyUrlBuilder.
+// A collection builder only inverts the urls of its collection, so at most one of them matches.
+func fromClusterUrl(servers []Server, builders map[string]UrlBuilder, u *url.URL) (HfLink, bool) {
+	try := func(collection string, b UrlBuilder) (HfLink, bool) {
+		var matched []HfLink
+		for _, server := range servers {
+			p, ok := b.ParseUrl(server, u)
+			if !ok {
+				continue
+			}
+			d, err := ParseHfLink(server.ClusterId + ":" + server.ServerId + p)
+			if err != nil || ("" != collection && d.Collection() != collection) {
+				continue
+			}
+			matched = append(matched, d)
+		}
+		if len(matched) != 1 {
+			return "", false
+		}
+		return matched[0], true
+	}
+	for collection, b := range builders {
+		if "" == collection {
+			continue
+		}
+		if d, ok := try(collection, b); ok {
+			return d, true
+		}
+	}
+	if b, ok := builders[""]; ok {
+		if d, ok := try("", b); ok {
+			return d, true
+		}
+	}
+	return try("", ProxyUrlBuilder{})
+}
+
+func stripQuery(u *url.URL) string {
+	v := *u
+	v.RawQuery, v.Fragment, v.RawFragment = "", "", ""
+	return v.String()
+}
+
+// ProxyUrlBuilder builds server.Proxy + path
+type ProxyUrlBuilder struct{}
+
+func (ProxyUrlBuilder) BuildUrl(server Server, path string) string {
+	return server.Proxy + path
+}
+func (ProxyUrlBuilder) ParseUrl(server Server, u *url.URL) (string, bool) {
+	if "" == server.Proxy {
+		return "", false
+	}
+	s := stripQuery(u)
+	proxy := strings.TrimSuffix(server.Proxy, "/")
+	if !strings.HasPrefix(s, proxy+"/") {
+		return "", false
+	}
+	return s[len(proxy):], true
+}
+
+// TemplateUrlBuilder builds Scheme://Host/PathPrefix/path?Query
+// Host and PathPrefix may contain {cluster} and {server}, PathPrefix may contain {collection}, which is then left out of path.
+// eg. {Scheme: "https", Host: "{server}.cdn.example.com", PathPrefix: "/{cluster}"}
+// Empty Scheme or Host are taken from server.Proxy. To be inverted by FromUrl, the url must tell the servers apart,
+// eg. by {server} in Host or PathPrefix.
+type TemplateUrlBuilder struct {
+	Scheme     string
+	Host       string
+	PathPrefix string
+	Query      url.Values
+}
+
+func (t TemplateUrlBuilder) base(server Server, collection string) string {
+	scheme, host := t.Scheme, t.Host
+	if "" == scheme || "" == host {
+		if pu, err := url.Parse(server.Proxy); err == nil {
+			if "" == scheme {
+				scheme = pu.Scheme
+			}
+			if "" == host {
+				host = pu.Host
+			}
+		}
+	}
+	r := strings.NewReplacer("{cluster}", server.ClusterId, "{server}", server.ServerId, "{collection}", collection)
+	return scheme + "://" + r.Replace(host) + strings.TrimSuffix(r.Replace(t.PathPrefix), "/")
+}
+
+func (t TemplateUrlBuilder) BuildUrl(server Server, path string) string {
+	collection := ""
+	if p, err := ParseHfPath(path); err == nil {
+		collection = p.Collection
+	}
+	if "" != collection && strings.Contains(t.PathPrefix, "{collection}") {
+		path = strings.TrimPrefix(path, "/"+collection)
+	}
+	s := t.base(server, collection) + path
+	if len(t.Query) > 0 {
+		s += "?" + t.Query.Encode()
+	}
+	return s
+}
+
+// templatePatterns caches the compiled ParseUrl patterns by their source, which depends on the builder and the server.
+var templatePatterns = struct {
+	sync.RWMutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+// pattern matches the urls built for server, the collection, if in the template, is the first group.
+func (t TemplateUrlBuilder) pattern(server Server) *regexp.Regexp {
+	src := regexp.QuoteMeta(t.base(server, "\x00"))
+	src = "^" + strings.Replace(src, "\x00", "([^/]+)", 1) + "(/.*)$"
+	templatePatterns.RLock()
+	re, ok := templatePatterns.m[src]
+	templatePatterns.RUnlock()
+	if ok {
+		return re
+	}
+	re = regexp.MustCompile(src)
+	templatePatterns.Lock()
+	templatePatterns.m[src] = re
+	templatePatterns.Unlock()
+	return re
+}
+
+func (t TemplateUrlBuilder) ParseUrl(server Server, u *url.URL) (string, bool) {
+	m := t.pattern(server).FindStringSubmatch(stripQuery(u))
+	if m == nil {
+		return "", false
+	}
+	if len(m) == 3 {
+		return "/" + m[1] + m[2], true
+	}
+	return m[1], true
+}
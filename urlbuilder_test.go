@@ -0,0 +1,64 @@
+package httpfsclient_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUrlBuilder(t *testing.T) {
+	cs := httpfsclient.GetClusters()
+	cs.AddServer(httpfsclient.Server{ClusterId: "cdnc", ServerId: "s1", Proxy: "http://10.0.0.1:8080"})
+	cs.AddServer(httpfsclient.Server{ClusterId: "cdnc", ServerId: "s2", Proxy: "http://10.0.0.2:8080"})
+	txt := httpfsclient.HfLink("cdnc:s2/txt/00/00/yyfoatapk5/bdu9kjosiq.go")
+	img := httpfsclient.HfLink("cdnc:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg")
+	assert.Equal(t, "http://10.0.0.2:8080/txt/00/00/yyfoatapk5/bdu9kjosiq.go", txt.Url())
+
+	httpfsclient.SetUrlBuilder("cdnc", "", httpfsclient.TemplateUrlBuilder{Scheme: "https", Host: "{server}.cdn.test", PathPrefix: "/{cluster}"})
+	httpfsclient.SetUrlBuilder("cdnc", httpfsclient.CollectionImage, httpfsclient.TemplateUrlBuilder{Host: "img.cdn.test", PathPrefix: "/{server}/{collection}", Query: url.Values{"v": {"2"}}})
+	defer httpfsclient.SetUrlBuilder("cdnc", "", nil)
+	defer httpfsclient.SetUrlBuilder("cdnc", httpfsclient.CollectionImage, nil)
+
+	assert.Equal(t, "https://s2.cdn.test/cdnc/txt/00/00/yyfoatapk5/bdu9kjosiq.go", txt.Url())
+	assert.Equal(t, "http://img.cdn.test/s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg?v=2", img.Url())
+	for _, d := range []httpfsclient.HfLink{txt, img} {
+		back, ok := httpfsclient.FromUrl(d.Url())
+		assert.True(t, ok, d.Url())
+		assert.Equal(t, d, back)
+		bs, _ := httpfsclient.FromHfLink(d).MarshalText()
+		assert.Equal(t, d.Url(), string(bs))
+	}
+
+	// old proxy urls and query strings still resolve
+	back, ok := httpfsclient.FromUrl("http://10.0.0.1:8080/image/00/00/gysz2c6aqf/joexrtxyco.jpg?x=1#top")
+	assert.True(t, ok)
+	assert.Equal(t, img, back)
+	for _, u := range []string{
+		"https://s3.cdn.test/cdnc/txt/a/b/c.go",
+		"http://img.cdn.test/s1/txt/00/00/a/b.jpg",
+		"https://other.test/cdnc/txt/00/00/a/b.go",
+	} {
+		_, ok = httpfsclient.FromUrl(u)
+		assert.False(t, ok, u)
+	}
+}
+
+func TestUrlBuilderAmbiguous(t *testing.T) {
+	cs := httpfsclient.GetClusters()
+	for _, clusterId := range []string{"ambb", "amba", "ambc"} {
+		cs.AddServer(httpfsclient.Server{ClusterId: clusterId, ServerId: "s1"})
+		httpfsclient.SetUrlBuilder(clusterId, "", httpfsclient.TemplateUrlBuilder{Scheme: "https", Host: "same.cdn.test"})
+		defer httpfsclient.SetUrlBuilder(clusterId, "", nil)
+	}
+	// every cluster builds the same url, it can not be told which one
+	_, ok := httpfsclient.FromUrl("https://same.cdn.test/txt/00/00/yyfoatapk5/bdu9kjosiq.go")
+	assert.False(t, ok)
+
+	httpfsclient.SetUrlBuilder("ambb", "", nil)
+	httpfsclient.SetUrlBuilder("ambc", "", nil)
+	back, ok := httpfsclient.FromUrl("https://same.cdn.test/txt/00/00/yyfoatapk5/bdu9kjosiq.go")
+	assert.True(t, ok)
+	assert.Equal(t, httpfsclient.HfLink("amba:s1/txt/00/00/yyfoatapk5/bdu9kjosiq.go"), back)
+}
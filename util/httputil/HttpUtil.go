@@ -1,8 +1,10 @@
 package httputil
 
 import (
+	"io"
 	"net/http"
 	netUrl "net/url"
+	"strconv"
 	"strings"
 
 	"github.com/mozillazg/request"
@@ -27,12 +29,42 @@ func HttpPost(url string, body string, retryCount int) (int, []byte, error) {
 	return resp.StatusCode, res, nil
 }
 
+// HeaderIdempotencyKey is sent with mutating requests, the same key is sent on every retry.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
 func HttpPostForm3(url string, form map[string]string, files []request.FileField) (int, []byte, error) {
 	return HttpPostForm(url, form, files, 3)
 }
 func HttpPostForm(url string, form map[string]string, files []request.FileField, retryCount int) (int, []byte, error) {
+	return HttpPostFormHeader(url, form, files, nil, retryCount)
+}
+
+// HttpPostFormIdempotent3 posts with the Idempotency-Key header, so that the server can drop the retries it already handled.
+func HttpPostFormIdempotent3(url string, form map[string]string, files []request.FileField, idempotencyKey string) (int, []byte, error) {
+	return HttpPostFormHeader(url, form, files, map[string]string{HeaderIdempotencyKey: idempotencyKey}, 3)
+}
+
+// rewind seeks the files back to their start for a retry, it returns false if a file can not seek.
+func rewind(files []request.FileField) bool {
+	for _, f := range files {
+		seeker, ok := f.File.(io.Seeker)
+		if !ok {
+			return false
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// HttpPostFormHeader posts a form with headers. A failed post is retried only if the files can be rewound.
+func HttpPostFormHeader(url string, form map[string]string, files []request.FileField, header map[string]string, retryCount int) (int, []byte, error) {
 	c := new(http.Client)
 	req := request.NewRequest(c)
+	for k, v := range header {
+		req.Headers[k] = v
+	}
 	req.Data = form
 	if len(files) > 0 {
 		// fileFields := make([]request.FileField, len(files))
@@ -54,8 +86,8 @@ func HttpPostForm(url string, form map[string]string, files []request.FileField,
 	}
 	resp, err := req.Post(url)
 	if err != nil {
-		if retryCount > 0 {
-			return HttpPostForm(url, form, files, retryCount-1)
+		if retryCount > 0 && rewind(files) {
+			return HttpPostFormHeader(url, form, files, header, retryCount-1)
 		}
 		return 0, nil, err
 	}
@@ -64,6 +96,24 @@ func HttpPostForm(url string, form map[string]string, files []request.FileField,
 	return resp.StatusCode, res, nil
 }
 
+// HttpPostFormStream posts a form with headers and returns the response unread, the caller closes its body.
+func HttpPostFormStream(url string, form map[string]string, header map[string]string, retryCount int) (*http.Response, error) {
+	c := new(http.Client)
+	req := request.NewRequest(c)
+	for k, v := range header {
+		req.Headers[k] = v
+	}
+	req.Data = form
+	resp, err := req.Post(url)
+	if err != nil {
+		if retryCount > 0 {
+			return HttpPostFormStream(url, form, header, retryCount-1)
+		}
+		return nil, err
+	}
+	return resp.Response, nil
+}
+
 func HttpQuery3(url string, param map[string]string, retryCount int) (int, []byte, error) {
 	return HttpQuery(url, param, 3)
 }
@@ -119,3 +169,23 @@ func HttpDelete(url string, form map[string]string, retryCount int) (int, []byte
 	res, err := resp.Content()
 	return resp.StatusCode, res, nil
 }
+
+// HttpGetRange gets n bytes at off with a Range header. The status is 206 if the server honoured the range.
+func HttpGetRange(url string, off, n int64, retryCount int) (int, []byte, error) {
+	c := new(http.Client)
+	req := request.NewRequest(c)
+	req.Headers["Range"] = "bytes=" + strconv.FormatInt(off, 10) + "-" + strconv.FormatInt(off+n-1, 10)
+	resp, err := req.Get(url)
+	if err != nil {
+		if retryCount > 0 {
+			return HttpGetRange(url, off, n, retryCount-1)
+		}
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return resp.StatusCode, nil, nil
+	}
+	res, err := resp.Content()
+	return resp.StatusCode, res, err
+}
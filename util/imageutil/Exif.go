@@ -0,0 +1,410 @@
+package imageutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+)
+
+// exif tags
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagArtist           = 0x013B
+	tagHostComputer     = 0x013C
+	tagSubIfds          = 0x014A
+	tagExifIfd          = 0x8769
+	tagGpsIfd           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagOffsetOriginal   = 0x9011
+	tagMakerNote        = 0x927C
+	tagUserComment      = 0x9286
+	tagInteropIfd       = 0xA005
+	tagImageUniqueId    = 0xA420
+	tagOwnerName        = 0xA430
+	tagBodySerial       = 0xA431
+	tagLensModel        = 0xA434
+	tagLensSerial       = 0xA435
+	tagXpTitle          = 0x9C9B
+	tagXpSubject        = 0x9C9F
+
+	tagGpsLatitudeRef  = 1
+	tagGpsLatitude     = 2
+	tagGpsLongitudeRef = 3
+	tagGpsLongitude    = 4
+	tagGpsAltitudeRef  = 5
+	tagGpsAltitude     = 6
+)
+
+// privateTags are dropped by MetadataStripPrivate, with the whole gps ifd.
+var privateTags = map[uint16]bool{
+	tagArtist: true, tagHostComputer: true, tagUserComment: true, tagImageUniqueId: true,
+	tagOwnerName: true, tagBodySerial: true, tagLensSerial: true,
+}
+
+// droppedTags are never written: the offsets inside maker notes and the sub ifds other than exif and gps break when the exif is rewritten.
+var droppedTags = map[uint16]bool{tagMakerNote: true, tagSubIfds: true, tagInteropIfd: true, tagExifIfd: true, tagGpsIfd: true}
+
+// sizes of the exif types, by type id
+var exifTypeSizes = [...]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// exifEntry is a tag with its value bytes, in the byte order of the exif.
+type exifEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+// Exif is the exif of a jpeg: its common tags, and all the tags of ifd0, exif and gps ifds to write them back.
+type Exif struct {
+	Orientation int    // 1-8, 0 if missing
+	Make, Model string // camera
+	LensModel   string
+	Software    string
+	// Time is when the photo was taken, DateTimeOriginal or else DateTime. In the local zone unless the exif has the offset.
+	Time                time.Time
+	HasGps              bool
+	Latitude, Longitude float64 // degrees, negative for south and west
+	Altitude            float64 // meters
+
+	order           binary.ByteOrder
+	ifd0, exif, gps []exifEntry
+}
+
+// ErrNoExif is returned by ReadExif for images without exif.
+var ErrNoExif = errors.New("imageutil: no exif")
+
+// ReadExif reads the exif of a jpeg.
+func ReadExif(r io.Reader) (*Exif, error) {
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tiff := jpegExif(bs)
+	if nil == tiff {
+		return nil, ErrNoExif
+	}
+	return parseExif(tiff)
+}
+
+// jpegExif returns the tiff data of the exif app1 segment, nil if there is none.
+func jpegExif(bs []byte) []byte {
+	if len(bs) < 4 || bs[0] != 0xFF || bs[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(bs); {
+		if bs[i] != 0xFF {
+			return nil
+		}
+		marker := bs[i+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(bs[i+2:]))
+		if size < 2 || i+2+size > len(bs) {
+			return nil
+		}
+		seg := bs[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		i += 2 + size
+	}
+	return nil
+}
+
+func parseExif(tiff []byte) (*Exif, error) {
+	e := &Exif{}
+	if len(tiff) < 8 {
+		return nil, ErrNoExif
+	}
+	switch string(tiff[:2]) {
+	case "II":
+		e.order = binary.LittleEndian
+	case "MM":
+		e.order = binary.BigEndian
+	default:
+		return nil, errors.New("imageutil: bad exif byte order")
+	}
+	var err error
+	if e.ifd0, err = e.readIfd(tiff, e.order.Uint32(tiff[4:])); err != nil {
+		return nil, err
+	}
+	if entry, ok := findEntry(e.ifd0, tagExifIfd); ok {
+		if e.exif, err = e.readIfd(tiff, e.uint(entry)); err != nil {
+			return nil, err
+		}
+	}
+	if entry, ok := findEntry(e.ifd0, tagGpsIfd); ok {
+		if e.gps, err = e.readIfd(tiff, e.uint(entry)); err != nil {
+			return nil, err
+		}
+	}
+	e.readTags()
+	return e, nil
+}
+
+func (e *Exif) readIfd(tiff []byte, offset uint32) ([]exifEntry, error) {
+	if int64(offset)+2 > int64(len(tiff)) {
+		return nil, errors.New("imageutil: bad exif ifd offset")
+	}
+	n := int(e.order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	if start+12*n > len(tiff) {
+		return nil, errors.New("imageutil: bad exif ifd size")
+	}
+	entries := make([]exifEntry, 0, n)
+	for i := 0; i < n; i++ {
+		raw := tiff[start+12*i : start+12*i+12]
+		entry := exifEntry{tag: e.order.Uint16(raw), typ: e.order.Uint16(raw[2:]), count: e.order.Uint32(raw[4:])}
+		if int(entry.typ) >= len(exifTypeSizes) || exifTypeSizes[entry.typ] == 0 {
+			continue
+		}
+		size := int64(entry.count) * int64(exifTypeSizes[entry.typ])
+		if size <= 4 {
+			entry.data = raw[8 : 8+size]
+		} else {
+			off := int64(e.order.Uint32(raw[8:]))
+			if off+size > int64(len(tiff)) {
+				continue
+			}
+			entry.data = tiff[off : off+size]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func findEntry(entries []exifEntry, tag uint16) (exifEntry, bool) {
+	for _, entry := range entries {
+		if entry.tag == tag {
+			return entry, true
+		}
+	}
+	return exifEntry{}, false
+}
+
+// uint returns the first value of a short or long entry.
+func (e *Exif) uint(entry exifEntry) uint32 {
+	switch {
+	case entry.typ == 3 && len(entry.data) >= 2:
+		return uint32(e.order.Uint16(entry.data))
+	case entry.typ == 4 && len(entry.data) >= 4:
+		return e.order.Uint32(entry.data)
+	case entry.typ == 1 && len(entry.data) >= 1:
+		return uint32(entry.data[0])
+	}
+	return 0
+}
+
+func (e *Exif) string(entries []exifEntry, tag uint16) string {
+	entry, ok := findEntry(entries, tag)
+	if !ok || entry.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(entry.data), "\x00"))
+}
+
+// rationals returns the values of an unsigned rational entry.
+func (e *Exif) rationals(entry exifEntry) []float64 {
+	if entry.typ != 5 {
+		return nil
+	}
+	var vs []float64
+	for i := 0; i+8 <= len(entry.data); i += 8 {
+		num, den := e.order.Uint32(entry.data[i:]), e.order.Uint32(entry.data[i+4:])
+		if den == 0 {
+			return nil
+		}
+		vs = append(vs, float64(num)/float64(den))
+	}
+	return vs
+}
+
+func (e *Exif) readTags() {
+	if entry, ok := findEntry(e.ifd0, tagOrientation); ok {
+		e.Orientation = int(e.uint(entry))
+	}
+	e.Make = e.string(e.ifd0, tagMake)
+	e.Model = e.string(e.ifd0, tagModel)
+	e.Software = e.string(e.ifd0, tagSoftware)
+	e.LensModel = e.string(e.exif, tagLensModel)
+	t := e.string(e.exif, tagDateTimeOriginal)
+	if "" == t {
+		t = e.string(e.ifd0, tagDateTime)
+	}
+	loc := time.Local
+	if offset := e.string(e.exif, tagOffsetOriginal); "" != offset {
+		if zone, err := time.Parse("-07:00", offset); err == nil {
+			loc = zone.Location()
+		}
+	}
+	e.Time, _ = time.ParseInLocation("2006:01:02 15:04:05", t, loc)
+
+	lat, okLat := findEntry(e.gps, tagGpsLatitude)
+	lon, okLon := findEntry(e.gps, tagGpsLongitude)
+	if okLat && okLon {
+		la, lo := degrees(e.rationals(lat)), degrees(e.rationals(lon))
+		if !math.IsNaN(la) && !math.IsNaN(lo) {
+			e.HasGps = true
+			e.Latitude, e.Longitude = la, lo
+			if "S" == e.string(e.gps, tagGpsLatitudeRef) {
+				e.Latitude = -la
+			}
+			if "W" == e.string(e.gps, tagGpsLongitudeRef) {
+				e.Longitude = -lo
+			}
+		}
+	}
+	if alt, ok := findEntry(e.gps, tagGpsAltitude); ok {
+		if vs := e.rationals(alt); len(vs) == 1 {
+			e.Altitude = vs[0]
+			if ref, ok := findEntry(e.gps, tagGpsAltitudeRef); ok && e.uint(ref) == 1 {
+				e.Altitude = -vs[0]
+			}
+		}
+	}
+}
+
+// degrees turns degrees, minutes and seconds to degrees.
+func degrees(dms []float64) float64 {
+	if len(dms) != 3 {
+		return math.NaN()
+	}
+	return dms[0] + dms[1]/60 + dms[2]/3600
+}
+
+// encode writes the exif as tiff data, without the private tags and the gps if stripPrivate.
+// orientation replaces the orientation tag if > 0.
+func (e *Exif) encode(stripPrivate bool, orientation int) []byte {
+	keep := func(entries []exifEntry) []exifEntry {
+		var kept []exifEntry
+		for _, entry := range entries {
+			if droppedTags[entry.tag] || (stripPrivate && (privateTags[entry.tag] || (entry.tag >= tagXpTitle && entry.tag <= tagXpSubject))) {
+				continue
+			}
+			if entry.tag == tagOrientation && orientation > 0 {
+				entry = exifEntry{tag: tagOrientation, typ: 3, count: 1, data: make([]byte, 2)}
+				e.order.PutUint16(entry.data, uint16(orientation))
+			}
+			kept = append(kept, entry)
+		}
+		return kept
+	}
+	ifd0, exif, gps := keep(e.ifd0), keep(e.exif), keep(e.gps)
+	if stripPrivate {
+		gps = nil
+	}
+	// the pointers are written with their final offsets below
+	exifAt, gpsAt := -1, -1
+	if len(exif) > 0 {
+		exifAt = len(ifd0)
+		ifd0 = append(ifd0, exifEntry{tag: tagExifIfd, typ: 4, count: 1, data: make([]byte, 4)})
+	}
+	if len(gps) > 0 {
+		gpsAt = len(ifd0)
+		ifd0 = append(ifd0, exifEntry{tag: tagGpsIfd, typ: 4, count: 1, data: make([]byte, 4)})
+	}
+	sortEntries(ifd0)
+	offset := 8 + ifdSize(ifd0)
+	if exifAt >= 0 {
+		setPointer(e.order, ifd0, tagExifIfd, uint32(offset))
+		offset += ifdSize(exif)
+	}
+	if gpsAt >= 0 {
+		setPointer(e.order, ifd0, tagGpsIfd, uint32(offset))
+	}
+
+	buf := new(bytes.Buffer)
+	if e.order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(buf, e.order, uint16(42))
+	binary.Write(buf, e.order, uint32(8))
+	writeIfd(buf, e.order, ifd0)
+	if exifAt >= 0 {
+		writeIfd(buf, e.order, exif)
+	}
+	if gpsAt >= 0 {
+		writeIfd(buf, e.order, gps)
+	}
+	return buf.Bytes()
+}
+
+func sortEntries(entries []exifEntry) {
+	for i := 1; i < len(entries); i++ {
+		for j := i; j > 0 && entries[j].tag < entries[j-1].tag; j-- {
+			entries[j], entries[j-1] = entries[j-1], entries[j]
+		}
+	}
+}
+
+func setPointer(order binary.ByteOrder, entries []exifEntry, tag uint16, offset uint32) {
+	for _, entry := range entries {
+		if entry.tag == tag {
+			order.PutUint32(entry.data, offset)
+		}
+	}
+}
+
+// ifdSize is the size of the ifd with its values, each value padded to an even size.
+func ifdSize(entries []exifEntry) int {
+	size := 2 + 12*len(entries) + 4
+	for _, entry := range entries {
+		if len(entry.data) > 4 {
+			size += len(entry.data) + len(entry.data)%2
+		}
+	}
+	return size
+}
+
+// writeIfd writes the ifd at buf.Len(), followed by the values that do not fit in the entries. There is no next ifd.
+func writeIfd(buf *bytes.Buffer, order binary.ByteOrder, entries []exifEntry) {
+	dataAt := buf.Len() + 2 + 12*len(entries) + 4
+	binary.Write(buf, order, uint16(len(entries)))
+	var data []byte
+	for _, entry := range entries {
+		binary.Write(buf, order, entry.tag)
+		binary.Write(buf, order, entry.typ)
+		binary.Write(buf, order, entry.count)
+		if len(entry.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, entry.data)
+			buf.Write(value)
+			continue
+		}
+		binary.Write(buf, order, uint32(dataAt+len(data)))
+		data = append(data, entry.data...)
+		if len(entry.data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	binary.Write(buf, order, uint32(0))
+	buf.Write(data)
+}
+
+// insertJpegExif adds an exif app1 segment after the start of image marker of a jpeg.
+func insertJpegExif(jpeg, tiff []byte) ([]byte, error) {
+	if len(jpeg) < 2 || jpeg[0] != 0xFF || jpeg[1] != 0xD8 {
+		return nil, errors.New("imageutil: not a jpeg")
+	}
+	size := 2 + 6 + len(tiff)
+	if size > 0xFFFF {
+		return nil, errors.New("imageutil: exif too large")
+	}
+	out := make([]byte, 0, len(jpeg)+2+size)
+	out = append(out, 0xFF, 0xD8, 0xFF, 0xE1, byte(size>>8), byte(size))
+	out = append(out, "Exif\x00\x00"...)
+	out = append(out, tiff...)
+	return append(out, jpeg[2:]...), nil
+}
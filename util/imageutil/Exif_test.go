@@ -0,0 +1,101 @@
+package imageutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+var le = binary.LittleEndian
+
+func asciiEntry(tag uint16, s string) exifEntry {
+	return exifEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+func shortEntry(tag uint16, v uint16) exifEntry {
+	data := make([]byte, 2)
+	le.PutUint16(data, v)
+	return exifEntry{tag: tag, typ: 3, count: 1, data: data}
+}
+func rationalEntry(tag uint16, vs ...uint32) exifEntry {
+	data := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		le.PutUint32(data[4*i:], v)
+	}
+	return exifEntry{tag: tag, typ: 5, count: uint32(len(vs) / 2), data: data}
+}
+
+// testJpeg is a 20x10 jpeg with orientation 6, taken at 31.5N 121.25W.
+func testJpeg(t *testing.T) []byte {
+	e := &Exif{order: le,
+		ifd0: []exifEntry{asciiEntry(tagMake, "Acme"), asciiEntry(tagModel, "A1"), shortEntry(tagOrientation, 6), asciiEntry(tagArtist, "Someone")},
+		exif: []exifEntry{asciiEntry(tagDateTimeOriginal, "2019:03:04 05:06:07"), asciiEntry(tagOffsetOriginal, "+08:00"), asciiEntry(tagBodySerial, "123456")},
+		gps: []exifEntry{asciiEntry(tagGpsLatitudeRef, "N"), rationalEntry(tagGpsLatitude, 31, 1, 30, 1, 0, 1),
+			asciiEntry(tagGpsLongitudeRef, "W"), rationalEntry(tagGpsLongitude, 121, 1, 15, 1, 0, 1), rationalEntry(tagGpsAltitude, 25, 2)},
+	}
+	buf := new(bytes.Buffer)
+	assert.Nil(t, imaging.Encode(buf, image.NewRGBA(image.Rect(0, 0, 20, 10)), imaging.JPEG))
+	bs, err := insertJpegExif(buf.Bytes(), e.encode(false, 0))
+	assert.Nil(t, err)
+	return bs
+}
+
+func TestReadExif(t *testing.T) {
+	e, err := ReadExif(bytes.NewReader(testJpeg(t)))
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme", e.Make)
+	assert.Equal(t, "A1", e.Model)
+	assert.Equal(t, 6, e.Orientation)
+	assert.True(t, e.Time.Equal(time.Date(2019, 3, 4, 5, 6, 7, 0, time.FixedZone("", 8*3600))))
+	assert.True(t, e.HasGps)
+	assert.Equal(t, 31.5, e.Latitude)
+	assert.Equal(t, -121.25, e.Longitude)
+	assert.Equal(t, 12.5, e.Altitude)
+
+	_, err = ReadExif(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xD9}))
+	assert.Equal(t, ErrNoExif, err)
+}
+
+func TestExifTransform(t *testing.T) {
+	src := testJpeg(t)
+	it, err := NewImageTransform(bytes.NewReader(src), imaging.JPEG)
+	assert.Nil(t, err)
+	assert.Equal(t, image.Pt(10, 20), it.Im.Bounds().Size())
+	it2, err := NewImageTransform(bytes.NewReader(src), imaging.JPEG, AutoOrient(false))
+	assert.Nil(t, err)
+	assert.Equal(t, image.Pt(20, 10), it2.Im.Bounds().Size())
+
+	buf, err := it.Buffer()
+	assert.Nil(t, err)
+	_, err = ReadExif(buf)
+	assert.Equal(t, ErrNoExif, err)
+
+	it.Metadata = MetadataKeep
+	buf, err = it.Buffer()
+	assert.Nil(t, err)
+	e, err := ReadExif(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, e.Orientation)
+	assert.True(t, e.HasGps)
+	assert.Equal(t, "Someone", e.string(e.ifd0, tagArtist))
+
+	it.Metadata = MetadataStripPrivate
+	buf, err = it.Buffer()
+	assert.Nil(t, err)
+	e, err = ReadExif(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme", e.Make)
+	assert.False(t, e.Time.IsZero())
+	assert.False(t, e.HasGps)
+	assert.Empty(t, e.gps)
+	assert.Equal(t, "", e.string(e.ifd0, tagArtist))
+	assert.Equal(t, "", e.string(e.exif, tagBodySerial))
+
+	p, _ := ParsePipeline("strip")
+	assert.Nil(t, it.Apply(p))
+	assert.Equal(t, MetadataDrop, it.Metadata)
+}
@@ -0,0 +1,143 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// Hash is a 64 bit perceptual hash, similar images have hashes at a small Distance.
+type Hash uint64
+
+// Distance is the hamming distance of the hashes, 0-64.
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// Similarity is 1 for equal hashes and 0 for opposite ones.
+func Similarity(a, b Hash) float64 {
+	return 1 - float64(Distance(a, b))/64
+}
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// ParseHash parses the hex of Hash.String.
+func ParseHash(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	return Hash(v), err
+}
+
+// grays returns the luma, 0-255, of the image resized to w x h.
+func grays(im image.Image, w, h int) []float64 {
+	small := imaging.Resize(im, w, h, imaging.Lanczos)
+	vs := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := small.Pix[y*small.Stride+4*x:]
+			vs[y*w+x] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+		}
+	}
+	return vs
+}
+
+// bitsAbove sets the bits of the values above the threshold, the first value is the highest bit.
+func bitsAbove(vs []float64, threshold float64) Hash {
+	var h Hash
+	for _, v := range vs {
+		h <<= 1
+		if v > threshold {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// AHash is the average hash: the 8x8 gray pixels brighter than their mean.
+func AHash(im image.Image) Hash {
+	vs := grays(im, 8, 8)
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	return bitsAbove(vs, sum/64)
+}
+
+// DHash is the difference hash: in each row of 9x8 gray pixels, the pixels brighter than their right neighbour.
+func DHash(im image.Image) Hash {
+	vs := grays(im, 9, 8)
+	var h Hash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if vs[y*9+x] > vs[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// dctCos[u][x] is cos((2x+1)uπ/64), for the dct of 32 values
+var dctCos = func() [32][32]float64 {
+	var c [32][32]float64
+	for u := 0; u < 32; u++ {
+		for x := 0; x < 32; x++ {
+			c[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 64)
+		}
+	}
+	return c
+}()
+
+// PHash is the dct hash: the 8x8 lowest frequencies of the dct of 32x32 gray pixels, above their median.
+// It is the most robust of the three to scaling, compression and small color changes.
+func PHash(im image.Image) Hash {
+	vs := grays(im, 32, 32)
+	// rows, then the columns of the 8 lowest frequencies of the rows
+	var rows [32][8]float64
+	for y := 0; y < 32; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 32; x++ {
+				s += vs[y*32+x] * dctCos[u][x]
+			}
+			rows[y][u] = s
+		}
+	}
+	low := make([]float64, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for y := 0; y < 32; y++ {
+				s += rows[y][u] * dctCos[v][y]
+			}
+			low[v*8+u] = s
+		}
+	}
+	// the dc term is the mean brightness, it is left out of the median
+	sorted := append([]float64(nil), low[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[31] + sorted[32]) / 2
+	return bitsAbove(low, median)
+}
+
+// HashReader decodes an image, orienting it by its exif, and returns its PHash.
+func HashReader(r io.Reader) (Hash, error) {
+	return HashReaderWith(r, PHash)
+}
+
+// HashReaderWith is HashReader with another hash, eg. AHash or DHash.
+func HashReaderWith(r io.Reader, hash func(image.Image) Hash) (Hash, error) {
+	im, err := imaging.Decode(r, imaging.AutoOrientation(true))
+	if err != nil {
+		return 0, err
+	}
+	return hash(im), nil
+}
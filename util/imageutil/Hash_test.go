@@ -0,0 +1,59 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPattern is a gradient with a dark disc at (cx, cy).
+func testPattern(w, h int, cx, cy float64) image.Image {
+	im := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := uint8(255 * (fx + fy) / 2)
+			if (fx-cx)*(fx-cx)+(fy-cy)*(fy-cy) < 0.04 {
+				v = 20
+			}
+			im.SetNRGBA(x, y, color.NRGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return im
+}
+
+func TestHash(t *testing.T) {
+	a := testPattern(400, 300, 0.3, 0.4)
+	scaled := imaging.Resize(a, 133, 100, imaging.Box)
+	buf := new(bytes.Buffer)
+	assert.Nil(t, imaging.Encode(buf, a, imaging.JPEG, imaging.JPEGQuality(40)))
+	compressed, err := imaging.Decode(buf)
+	assert.Nil(t, err)
+	other := imaging.FlipH(testPattern(400, 300, 0.7, 0.7))
+
+	for name, hash := range map[string]func(image.Image) Hash{"a": AHash, "d": DHash, "p": PHash} {
+		h := hash(a)
+		assert.True(t, Distance(h, hash(scaled)) <= 6, name)
+		assert.True(t, Distance(h, hash(compressed)) <= 6, name)
+		assert.True(t, Distance(h, hash(other)) > 12, name)
+	}
+
+	h := PHash(a)
+	assert.Equal(t, 0, Distance(h, h))
+	assert.Equal(t, 1.0, Similarity(h, h))
+	assert.Equal(t, 64, Distance(0, ^Hash(0)))
+	parsed, err := ParseHash(h.String())
+	assert.Nil(t, err)
+	assert.Equal(t, h, parsed)
+	assert.Len(t, h.String(), 16)
+
+	buf.Reset()
+	assert.Nil(t, imaging.Encode(buf, a, imaging.PNG))
+	fromReader, err := HashReader(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, h, fromReader)
+}
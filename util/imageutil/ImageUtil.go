@@ -3,18 +3,53 @@ package imageutil
 import (
 	"bytes"
 	"image"
+	"image/png"
 	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/disintegration/imaging"
 )
 
+// what Buffer writes of the source exif
+const (
+	MetadataDrop         = 0 // no metadata
+	MetadataKeep         = 1 // the exif, without maker notes and thumbnail
+	MetadataStripPrivate = 2 // as MetadataKeep, without gps, serial numbers, owner and comments
+)
+
 type ImageTransform struct {
 	Im     image.Image
 	Format imaging.Format
+	// Quality is the jpeg quality 1-100, 0 means the default of imaging.
+	Quality int
+	// Compression is the png compression level.
+	Compression png.CompressionLevel
+	// Exif of the source jpeg, nil if none.
+	Exif *Exif
+	// Metadata is one of Metadata*, only jpeg outputs get the exif.
+	Metadata int
+	// Resizing are the options of the resizes of Apply.
+	Resizing ResizeOptions
+	// Target is the format of the last format op of Apply, "" if none. Buffer refuses "webp", Format is then the format before it.
+	Target   string
+	oriented bool
 }
 
-func NewImageFileTransform(filename string) (*ImageTransform, error) {
+type decodeConfig struct {
+	autoOrient bool
+}
+
+type DecodeOption func(*decodeConfig)
+
+// AutoOrient rotates and flips jpegs by their exif orientation on decode, on by default.
+func AutoOrient(enabled bool) DecodeOption {
+	return func(c *decodeConfig) {
+		c.autoOrient = enabled
+	}
+}
+
+func NewImageFileTransform(filename string, opts ...DecodeOption) (*ImageTransform, error) {
 	format, err := imaging.FormatFromFilename(filename)
 	if err != nil {
 		return nil, err
@@ -24,15 +59,27 @@ func NewImageFileTransform(filename string) (*ImageTransform, error) {
 		return nil, err
 	}
 	defer f.Close()
-	return NewImageTransform(f, format)
+	return NewImageTransform(f, format, opts...)
 }
-func NewImageTransform(file io.Reader, format imaging.Format) (*ImageTransform, error) {
+func NewImageTransform(file io.Reader, format imaging.Format, opts ...DecodeOption) (*ImageTransform, error) {
+	config := decodeConfig{autoOrient: true}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	bs, err := ioutil.ReadAll(file)
+	if nil != err {
+		return nil, err
+	}
 	t := &ImageTransform{Format: format}
-	im, err := imaging.Decode(file)
+	if tiff := jpegExif(bs); nil != tiff {
+		t.Exif, _ = parseExif(tiff)
+	}
+	im, err := imaging.Decode(bytes.NewReader(bs), imaging.AutoOrientation(config.autoOrient))
 	if nil != err {
 		return nil, err
 	}
 	t.Im = im
+	t.oriented = config.autoOrient && nil != t.Exif && t.Exif.Orientation > 1
 	return t, nil
 }
 func (t *ImageTransform) CropRect(rect image.Rectangle) *ImageTransform {
@@ -47,29 +94,65 @@ func (t *ImageTransform) Resize(w, h int) *ImageTransform {
 	t.Im = imaging.Resize(t.Im, w, h, imaging.Linear)
 	return t
 }
+func (t *ImageTransform) encodeOptions() []imaging.EncodeOption {
+	opts := []imaging.EncodeOption{imaging.PNGCompressionLevel(t.Compression)}
+	if t.Quality > 0 {
+		opts = append(opts, imaging.JPEGQuality(t.Quality))
+	}
+	return opts
+}
+
+// Buffer encodes in t.Format, ErrWebpEncode if the Target is webp.
 func (t *ImageTransform) Buffer() (*bytes.Buffer, error) {
+	if "webp" == t.Target {
+		return nil, ErrWebpEncode
+	}
+	return t.encode()
+}
+
+// Preview is Buffer, but a webp Target is encoded in t.Format, eg. to show what a pipeline run on the server gives.
+func (t *ImageTransform) Preview() (*bytes.Buffer, error) {
+	return t.encode()
+}
+
+func (t *ImageTransform) encode() (*bytes.Buffer, error) {
 	buff := new(bytes.Buffer)
-	err := imaging.Encode(buff, t.Im, t.Format)
+	err := imaging.Encode(buff, t.Im, t.Format, t.encodeOptions()...)
+	if nil != err {
+		return nil, err
+	}
+	if MetadataDrop == t.Metadata || nil == t.Exif || imaging.JPEG != t.Format {
+		return buff, nil
+	}
+	orientation := 0
+	if t.oriented {
+		orientation = 1 // the pixels are upright already
+	}
+	bs, err := insertJpegExif(buff.Bytes(), t.Exif.encode(MetadataStripPrivate == t.Metadata, orientation))
 	if nil != err {
 		return nil, err
 	}
-	return buff, nil
+	return bytes.NewBuffer(bs), nil
 }
+
+// Save encodes by the extension of filePath, without metadata.
 func (t *ImageTransform) Save(filePath string) error {
-	return imaging.Save(t.Im, filePath)
+	return imaging.Save(t.Im, filePath, t.encodeOptions()...)
 }
+
+// Write encodes in t.Format to filename, with t.Quality.
 func (t *ImageTransform) Write(filename string) error {
-	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	src, err := t.Buffer()
 	if nil != err {
 		return err
 	}
-	defer f.Close()
-	src, err := t.Buffer()
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if nil != err {
 		return err
 	}
-	io.Copy(f, src)
-	return nil
+	defer f.Close()
+	_, err = io.Copy(f, src)
+	return err
 }
 
 // func GetImageFormat(filename string) (imaging.Format, error) {
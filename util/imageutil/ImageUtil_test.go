@@ -9,5 +9,6 @@ func TestImageTransform(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	it.Crop(10, 10, 100, 100).Resize(200, 200).Write("b.jpg", 80)
+	it.Quality = 80
+	it.Crop(10, 10, 100, 100).Resize(200, 200).Write("b.jpg")
 }
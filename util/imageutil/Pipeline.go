@@ -0,0 +1,261 @@
+package imageutil
+
+import (
+	"errors"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// pipeline ops, the same names are understood by the image/transform method of the server
+const (
+	OpCrop     = "crop"      // crop:x,y,w,h
+	OpResize   = "resize"    // resize:WxH, 0 keeps the ratio
+	OpFit      = "fit"       // fit:WxH, scale to fit in WxH, keeping the ratio
+	OpFill     = "fill"      // fill:WxH, scale and crop the center to WxH
+	OpPad      = "pad"       // pad:WxH, fit in WxH and pad with the background
+	OpSmart    = "smart"     // smart:WxH, scale and crop the most salient part to WxH
+	OpWidth    = "width"     // width:W, keeping the ratio
+	OpHeight   = "height"    // height:H, keeping the ratio
+	OpFilter   = "filter"    // filter:lanczos, catmullrom, box, nearest or linear, for the next resizes
+	OpBg       = "bg"        // bg:#rrggbb, the background of the next pads
+	OpNoUp     = "noupscale" // never scale up in the next resizes
+	OpRotate   = "rotate"    // rotate:degrees, counter clockwise
+	OpFlip     = "flip"      // flip:h or flip:v
+	OpFormat   = "format"    // format:jpeg, png or webp
+	OpQuality  = "quality"   // quality:1-100
+	OpCompress = "compress"  // compress:0-9, png compression level
+	OpStrip    = "strip"     // strip metadata, see MetadataDrop
+)
+
+// Op is a step of a Pipeline, Nums holds the numbers of the op and Arg its word, eg. the format.
+type Op struct {
+	Name string
+	Nums []int
+	Arg  string
+}
+
+// Pipeline is a list of ops applied in order, written as "crop:10,10,100,100|fit:60x60|format:webp|quality:80".
+type Pipeline []Op
+
+type opSyntax struct {
+	nums     int    // count of numbers
+	sep      string // separator of the numbers
+	args     []string
+	color    bool
+	min, max int
+}
+
+var opSyntaxes = map[string]opSyntax{
+	OpCrop:     {nums: 4, sep: ",", min: 0, max: 1 << 16},
+	OpResize:   {nums: 2, sep: "x", min: 0, max: 1 << 16},
+	OpFit:      {nums: 2, sep: "x", min: 1, max: 1 << 16},
+	OpFill:     {nums: 2, sep: "x", min: 1, max: 1 << 16},
+	OpPad:      {nums: 2, sep: "x", min: 1, max: 1 << 16},
+	OpSmart:    {nums: 2, sep: "x", min: 1, max: 1 << 16},
+	OpWidth:    {nums: 1, min: 1, max: 1 << 16},
+	OpHeight:   {nums: 1, min: 1, max: 1 << 16},
+	OpFilter:   {args: []string{"lanczos", "catmullrom", "box", "nearest", "linear"}},
+	OpBg:       {color: true},
+	OpNoUp:     {},
+	OpRotate:   {nums: 1, min: -360, max: 360},
+	OpFlip:     {args: []string{"h", "v"}},
+	OpFormat:   {args: []string{"jpeg", "png", "webp"}},
+	OpQuality:  {nums: 1, min: 1, max: 100},
+	OpCompress: {nums: 1, min: 0, max: 9},
+	OpStrip:    {},
+}
+
+// ParsePipeline parses a pipeline spec, see Pipeline.
+func ParsePipeline(spec string) (Pipeline, error) {
+	spec = strings.TrimSpace(spec)
+	if "" == spec {
+		return nil, errors.New("empty pipeline")
+	}
+	var p Pipeline
+	for _, s := range strings.Split(spec, "|") {
+		op, err := ParseOp(s)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, op)
+	}
+	return p, nil
+}
+
+// ParseOp parses one op of a pipeline spec, eg. "fit:60x60".
+func ParseOp(s string) (Op, error) {
+	s = strings.TrimSpace(s)
+	name, args := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		name, args = s[:i], s[i+1:]
+	}
+	op := Op{Name: name}
+	syntax, ok := opSyntaxes[name]
+	if !ok {
+		return op, errors.New("unknown pipeline op:" + strconv.Quote(s))
+	}
+	switch {
+	case syntax.nums > 0:
+		parts := []string{args}
+		if "" != syntax.sep {
+			parts = strings.Split(args, syntax.sep)
+		}
+		if len(parts) != syntax.nums {
+			return op, errors.New("pipeline op " + strconv.Quote(s) + " needs " + strconv.Itoa(syntax.nums) + " numbers")
+		}
+		for _, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < syntax.min || n > syntax.max {
+				return op, errors.New("pipeline op " + strconv.Quote(s) + " numbers must be " + strconv.Itoa(syntax.min) + "-" + strconv.Itoa(syntax.max))
+			}
+			op.Nums = append(op.Nums, n)
+		}
+		if name == OpResize && op.Nums[0] == 0 && op.Nums[1] == 0 {
+			return op, errors.New("pipeline op " + strconv.Quote(s) + " needs a width or a height")
+		}
+	case syntax.color:
+		if _, err := ParseColor(args); err != nil {
+			return op, errors.New("pipeline op " + strconv.Quote(s) + " needs a color as #rrggbb")
+		}
+		op.Arg = args
+	case len(syntax.args) > 0:
+		for _, a := range syntax.args {
+			if a == args {
+				op.Arg = args
+			}
+		}
+		if "" == op.Arg {
+			return op, errors.New("pipeline op " + strconv.Quote(s) + " must be one of " + strings.Join(syntax.args, ","))
+		}
+	case "" != args:
+		return op, errors.New("pipeline op " + strconv.Quote(s) + " takes no argument")
+	}
+	return op, nil
+}
+
+func (op Op) String() string {
+	syntax := opSyntaxes[op.Name]
+	switch {
+	case syntax.nums > 0:
+		nums := make([]string, len(op.Nums))
+		for i, n := range op.Nums {
+			nums[i] = strconv.Itoa(n)
+		}
+		return op.Name + ":" + strings.Join(nums, syntax.sep)
+	case "" != op.Arg:
+		return op.Name + ":" + op.Arg
+	}
+	return op.Name
+}
+
+// String returns the spec of the pipeline, ParsePipeline(p.String()) equals p.
+func (p Pipeline) String() string {
+	ops := make([]string, len(p))
+	for i, op := range p {
+		ops[i] = op.String()
+	}
+	return strings.Join(ops, "|")
+}
+
+// ErrWebpEncode is returned by Buffer and Write after format:webp, there is no webp encoder in go.
+// Run such pipelines on the server, or encode a preview with Preview.
+var ErrWebpEncode = errors.New("imageutil: webp can not be encoded locally")
+
+// Apply runs the pipeline on the image, the encoding ops set the options of Buffer and Write.
+func (t *ImageTransform) Apply(p Pipeline) error {
+	for _, op := range p {
+		n := op.Nums
+		switch op.Name {
+		case OpCrop:
+			t.Crop(n[0], n[1], n[2], n[3])
+		case OpResize:
+			t.resizeMode(n[0], n[1], ResizeStretch)
+		case OpFit:
+			t.resizeMode(n[0], n[1], ResizeFit)
+		case OpFill:
+			t.resizeMode(n[0], n[1], ResizeFill)
+		case OpPad:
+			t.resizeMode(n[0], n[1], ResizePad)
+		case OpSmart:
+			t.resizeMode(n[0], n[1], ResizeSmart)
+		case OpWidth:
+			t.resizeMode(n[0], 0, ResizeWidth)
+		case OpHeight:
+			t.resizeMode(0, n[0], ResizeHeight)
+		case OpFilter:
+			t.Resizing.Filter = op.Arg
+			if "linear" == op.Arg {
+				t.Resizing.Filter = FilterLinear
+			}
+		case OpBg:
+			t.Resizing.Background, _ = ParseColor(op.Arg)
+		case OpNoUp:
+			t.Resizing.NoUpscale = true
+		case OpRotate:
+			t.Rotate(n[0])
+		case OpFlip:
+			if "h" == op.Arg {
+				t.Im = imaging.FlipH(t.Im)
+			} else {
+				t.Im = imaging.FlipV(t.Im)
+			}
+		case OpFormat:
+			t.Target = op.Arg
+			switch op.Arg {
+			case "jpeg":
+				t.Format = imaging.JPEG
+			case "png":
+				t.Format = imaging.PNG
+			}
+		case OpQuality:
+			t.Quality = n[0]
+		case OpCompress:
+			t.Compression = pngCompression(n[0])
+		case OpStrip:
+			t.Metadata = MetadataDrop
+		default:
+			return errors.New("unknown pipeline op:" + strconv.Quote(op.Name))
+		}
+	}
+	return nil
+}
+
+// resizeMode resizes with t.Resizing in mode.
+func (t *ImageTransform) resizeMode(w, h int, mode string) {
+	o := t.Resizing
+	o.Mode = mode
+	t.ResizeWith(w, h, o)
+}
+
+// Rotate rotates by degrees counter clockwise, the corners uncovered by other angles than right ones are transparent.
+func (t *ImageTransform) Rotate(degrees int) *ImageTransform {
+	switch (degrees%360 + 360) % 360 {
+	case 0:
+	case 90:
+		t.Im = imaging.Rotate90(t.Im)
+	case 180:
+		t.Im = imaging.Rotate180(t.Im)
+	case 270:
+		t.Im = imaging.Rotate270(t.Im)
+	default:
+		t.Im = imaging.Rotate(t.Im, float64(degrees), color.Transparent)
+	}
+	return t
+}
+
+// pngCompression maps a 0-9 level to the levels of image/png.
+func pngCompression(level int) png.CompressionLevel {
+	switch {
+	case level == 0:
+		return png.NoCompression
+	case level <= 3:
+		return png.BestSpeed
+	case level <= 6:
+		return png.DefaultCompression
+	}
+	return png.BestCompression
+}
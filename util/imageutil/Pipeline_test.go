@@ -0,0 +1,60 @@
+package imageutil
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePipeline(t *testing.T) {
+	spec := "crop:10,10,100,100|fit:60x60|format:webp|quality:80"
+	p, err := ParsePipeline(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, Pipeline{
+		{Name: OpCrop, Nums: []int{10, 10, 100, 100}},
+		{Name: OpFit, Nums: []int{60, 60}},
+		{Name: OpFormat, Arg: "webp"},
+		{Name: OpQuality, Nums: []int{80}},
+	}, p)
+	assert.Equal(t, spec, p.String())
+	p, err = ParsePipeline(" resize:0x200 | flip:h|strip|rotate:-90|compress:9 ")
+	assert.Nil(t, err)
+	assert.Equal(t, "resize:0x200|flip:h|strip|rotate:-90|compress:9", p.String())
+
+	for _, bad := range []string{"", "blur:3", "crop:1,2,3", "fit:60", "fit:0x60", "resize:0x0", "quality:0", "quality:101", "flip:x", "format:gif", "strip:1", "crop:a,b,c,d", "fit:60x60|"} {
+		_, err = ParsePipeline(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestApplyPipeline(t *testing.T) {
+	it := &ImageTransform{Im: image.NewRGBA(image.Rect(0, 0, 400, 300)), Format: imaging.PNG}
+	p, _ := ParsePipeline("crop:0,0,200,100|fit:60x60|rotate:90|format:jpeg|quality:80")
+	assert.Nil(t, it.Apply(p))
+	assert.Equal(t, image.Pt(30, 60), it.Im.Bounds().Size())
+	assert.Equal(t, imaging.JPEG, it.Format)
+	assert.Equal(t, 80, it.Quality)
+	_, err := it.Buffer()
+	assert.Nil(t, err)
+
+	p, _ = ParsePipeline("fill:50x50|format:webp|rotate:90")
+	assert.Nil(t, it.Apply(p))
+	assert.Equal(t, image.Pt(50, 50), it.Im.Bounds().Size())
+	assert.Equal(t, "webp", it.Target)
+	assert.Equal(t, imaging.JPEG, it.Format)
+	_, err = it.Buffer()
+	assert.Equal(t, ErrWebpEncode, err)
+	out := filepath.Join(t.TempDir(), "a.webp")
+	assert.Equal(t, ErrWebpEncode, it.Write(out))
+	_, err = os.Stat(out)
+	assert.True(t, os.IsNotExist(err))
+	preview, err := it.Preview()
+	assert.Nil(t, err)
+	_, format, err := image.DecodeConfig(preview)
+	assert.Nil(t, err)
+	assert.Equal(t, "jpeg", format)
+}
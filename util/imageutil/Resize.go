@@ -0,0 +1,166 @@
+package imageutil
+
+import (
+	"errors"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// resize modes
+const (
+	ResizeStretch = ""       // exactly w x h, a 0 side keeps the ratio
+	ResizeFit     = "fit"    // within w x h, keeping the ratio
+	ResizeFill    = "fill"   // cover w x h keeping the ratio, then crop the center
+	ResizePad     = "pad"    // fit, then pad to w x h with the background
+	ResizeWidth   = "width"  // to width w, keeping the ratio
+	ResizeHeight  = "height" // to height h, keeping the ratio
+	ResizeSmart   = "smart"  // as ResizeFill, cropping the most salient part instead of the center, see SmartCrop
+)
+
+// resample filters
+const (
+	FilterLinear          = "" // the default
+	FilterLanczos         = "lanczos"
+	FilterCatmullRom      = "catmullrom"
+	FilterBox             = "box"
+	FilterNearestNeighbor = "nearest"
+)
+
+var filters = map[string]imaging.ResampleFilter{
+	FilterLinear:          imaging.Linear,
+	"linear":              imaging.Linear,
+	FilterLanczos:         imaging.Lanczos,
+	FilterCatmullRom:      imaging.CatmullRom,
+	FilterBox:             imaging.Box,
+	FilterNearestNeighbor: imaging.NearestNeighbor,
+}
+
+// IsResizeMode tells if mode is one of Resize*.
+func IsResizeMode(mode string) bool {
+	switch mode {
+	case ResizeStretch, ResizeFit, ResizeFill, ResizePad, ResizeWidth, ResizeHeight, ResizeSmart:
+		return true
+	}
+	return false
+}
+
+// IsFilter tells if filter is one of Filter*.
+func IsFilter(filter string) bool {
+	_, ok := filters[filter]
+	return ok
+}
+
+type ResizeOptions struct {
+	Mode       string      // Resize*
+	Filter     string      // Filter*
+	Background color.Color // of ResizePad, nil is transparent
+	NoUpscale  bool        // never scale up: the output is at most the source size, ResizePad still pads to w x h
+}
+
+// ResizeWith resizes to w x h as o.Mode says.
+func (t *ImageTransform) ResizeWith(w, h int, o ResizeOptions) *ImageTransform {
+	filter := filters[o.Filter]
+	sw, sh := t.Im.Bounds().Dx(), t.Im.Bounds().Dy()
+	if sw == 0 || sh == 0 {
+		return t
+	}
+	capScale := func(scale float64) float64 {
+		if o.NoUpscale && scale > 1 {
+			return 1
+		}
+		return scale
+	}
+	scaled := func(scale float64) (int, int) {
+		return maxInt(1, int(math.Round(float64(sw)*scale))), maxInt(1, int(math.Round(float64(sh)*scale)))
+	}
+	fx, fy := float64(w)/float64(sw), float64(h)/float64(sh)
+	switch o.Mode {
+	case ResizeFit, ResizePad:
+		if 0 == w && 0 == h {
+			return t
+		}
+		scale := capScale(math.Min(fx, fy))
+		if 0 == w {
+			scale = capScale(fy)
+		} else if 0 == h {
+			scale = capScale(fx)
+		}
+		nw, nh := scaled(scale)
+		t.Im = imaging.Resize(t.Im, nw, nh, filter)
+		if o.Mode == ResizePad && w > 0 && h > 0 && (nw != w || nh != h) {
+			bg := o.Background
+			if nil == bg {
+				bg = color.Transparent
+			}
+			t.Im = imaging.PasteCenter(imaging.New(w, h, bg), t.Im)
+		}
+	case ResizeFill:
+		if 0 == w || 0 == h {
+			return t.ResizeWith(w, h, ResizeOptions{Mode: ResizeFit, Filter: o.Filter, NoUpscale: o.NoUpscale})
+		}
+		scale := capScale(math.Max(fx, fy))
+		nw, nh := scaled(scale)
+		t.Im = imaging.Resize(t.Im, nw, nh, filter)
+		t.Im = imaging.CropCenter(t.Im, minInt(w, nw), minInt(h, nh))
+	case ResizeSmart:
+		if 0 == w || 0 == h {
+			return t.ResizeWith(w, h, ResizeOptions{Mode: ResizeFit, Filter: o.Filter, NoUpscale: o.NoUpscale})
+		}
+		t.SmartCrop(w, h)
+		if !o.NoUpscale || t.Im.Bounds().Dx() > w {
+			t.Im = imaging.Resize(t.Im, w, h, filter)
+		}
+	case ResizeWidth:
+		if 0 == w {
+			return t
+		}
+		nw, nh := scaled(capScale(fx))
+		t.Im = imaging.Resize(t.Im, nw, nh, filter)
+	case ResizeHeight:
+		if 0 == h {
+			return t
+		}
+		nw, nh := scaled(capScale(fy))
+		t.Im = imaging.Resize(t.Im, nw, nh, filter)
+	default:
+		if o.NoUpscale {
+			w, h = minInt(w, sw), minInt(h, sh)
+		}
+		t.Im = imaging.Resize(t.Im, w, h, filter)
+	}
+	return t
+}
+
+// ParseColor parses "#rgb", "#rrggbb" or "#rrggbbaa", the # is optional.
+func ParseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return nil, errors.New("imageutil: bad color " + strconv.Quote(s))
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
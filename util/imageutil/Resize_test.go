@@ -0,0 +1,66 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResizeWith(t *testing.T) {
+	size := func(w, h int, o ResizeOptions) image.Point {
+		it := &ImageTransform{Im: image.NewNRGBA(image.Rect(0, 0, 400, 200))}
+		return it.ResizeWith(w, h, o).Im.Bounds().Size()
+	}
+	assert.Equal(t, image.Pt(100, 100), size(100, 100, ResizeOptions{}))
+	assert.Equal(t, image.Pt(100, 50), size(100, 0, ResizeOptions{}))
+	assert.Equal(t, image.Pt(100, 50), size(100, 100, ResizeOptions{Mode: ResizeFit}))
+	assert.Equal(t, image.Pt(800, 400), size(1000, 400, ResizeOptions{Mode: ResizeFit, Filter: FilterLanczos}))
+	assert.Equal(t, image.Pt(400, 200), size(1000, 400, ResizeOptions{Mode: ResizeFit, NoUpscale: true}))
+	assert.Equal(t, image.Pt(100, 100), size(100, 100, ResizeOptions{Mode: ResizeFill, Filter: FilterCatmullRom}))
+	assert.Equal(t, image.Pt(300, 200), size(300, 300, ResizeOptions{Mode: ResizeFill, NoUpscale: true}))
+	assert.Equal(t, image.Pt(100, 100), size(100, 100, ResizeOptions{Mode: ResizePad, Filter: FilterBox}))
+	assert.Equal(t, image.Pt(500, 500), size(500, 500, ResizeOptions{Mode: ResizePad, NoUpscale: true}))
+	assert.Equal(t, image.Pt(200, 100), size(200, 999, ResizeOptions{Mode: ResizeWidth, Filter: FilterNearestNeighbor}))
+	assert.Equal(t, image.Pt(400, 200), size(800, 0, ResizeOptions{Mode: ResizeWidth, NoUpscale: true}))
+	assert.Equal(t, image.Pt(100, 50), size(999, 50, ResizeOptions{Mode: ResizeHeight}))
+	assert.Equal(t, image.Pt(400, 200), size(800, 800, ResizeOptions{NoUpscale: true}))
+
+	it := &ImageTransform{Im: image.NewNRGBA(image.Rect(0, 0, 400, 200))}
+	it.ResizeWith(100, 100, ResizeOptions{Mode: ResizePad, Background: color.White})
+	assert.Equal(t, color.NRGBA{255, 255, 255, 255}, it.Im.At(50, 5))
+	assert.Equal(t, color.NRGBA{0, 0, 0, 0}, it.Im.At(50, 50))
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := ParseColor("#ff8000")
+	assert.Nil(t, err)
+	assert.Equal(t, color.NRGBA{255, 128, 0, 255}, c)
+	c, err = ParseColor("f80")
+	assert.Nil(t, err)
+	assert.Equal(t, color.NRGBA{255, 136, 0, 255}, c)
+	c, err = ParseColor("#00000080")
+	assert.Nil(t, err)
+	assert.Equal(t, color.NRGBA{0, 0, 0, 128}, c)
+	for _, bad := range []string{"", "#ff80", "#gg0000", "red"} {
+		_, err = ParseColor(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestPipelineResize(t *testing.T) {
+	p, err := ParsePipeline("filter:lanczos|bg:#ffffff|noupscale|pad:800x800|width:100")
+	assert.Nil(t, err)
+	assert.Equal(t, "filter:lanczos|bg:#ffffff|noupscale|pad:800x800|width:100", p.String())
+	it := &ImageTransform{Im: image.NewNRGBA(image.Rect(0, 0, 400, 200))}
+	assert.Nil(t, it.Apply(p))
+	assert.Equal(t, image.Pt(100, 100), it.Im.Bounds().Size())
+	assert.Equal(t, FilterLanczos, it.Resizing.Filter)
+	assert.True(t, it.Resizing.NoUpscale)
+
+	for _, bad := range []string{"bg:white", "filter:bicubic", "width:0", "pad:10", "noupscale:1"} {
+		_, err = ParsePipeline(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
@@ -0,0 +1,144 @@
+package imageutil
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// the long side of the copy SmartCrop analyses
+const smartCropAnalyseSize = 256
+
+// weights of the saliency features
+const (
+	edgeWeight       = 0.2
+	skinWeight       = 1.8
+	saturationWeight = 0.3
+)
+
+// skin tone as normalized rgb
+var skinColor = [3]float64{0.78, 0.57, 0.44}
+
+// SmartCrop returns the largest rect of the ratio w:h that holds the most salient part of the image:
+// edges, saturated colors and skin tones, skin weighing the most. Ties go to the rect nearest the center.
+func SmartCrop(im image.Image, w, h int) image.Rectangle {
+	b := im.Bounds()
+	if w <= 0 || h <= 0 || b.Empty() {
+		return b
+	}
+	cw, ch := b.Dx(), maxInt(1, int(math.Round(float64(b.Dx())*float64(h)/float64(w))))
+	if ch > b.Dy() {
+		cw, ch = maxInt(1, int(math.Round(float64(b.Dy())*float64(w)/float64(h)))), b.Dy()
+	}
+	if cw >= b.Dx() && ch >= b.Dy() {
+		return b
+	}
+	scale := math.Min(1, smartCropAnalyseSize/float64(maxInt(b.Dx(), b.Dy())))
+	small := imaging.Resize(im, maxInt(1, int(math.Round(float64(b.Dx())*scale))), maxInt(1, int(math.Round(float64(b.Dy())*scale))), imaging.Box)
+	sw, sh := small.Bounds().Dx(), small.Bounds().Dy()
+	scores := saliency(small)
+
+	// the rect is as wide or as high as the image, so it only slides along the other axis
+	horizontal := cw < b.Dx()
+	n, size, full := sh, ch, b.Dy()
+	if horizontal {
+		n, size, full = sw, cw, b.Dx()
+	}
+	lines := make([]float64, n+1) // prefix sums of the lines across the axis
+	for i := 0; i < n; i++ {
+		var sum float64
+		if horizontal {
+			for y := 0; y < sh; y++ {
+				sum += scores[y*sw+i]
+			}
+		} else {
+			for x := 0; x < sw; x++ {
+				sum += scores[i*sw+x]
+			}
+		}
+		lines[i+1] = lines[i] + sum
+	}
+	window := minInt(n, maxInt(1, int(math.Round(float64(size)*float64(n)/float64(full)))))
+	mid := float64(n-window) / 2
+	best, bestScore := 0, math.Inf(-1)
+	for i := 0; i+window <= n; i++ {
+		score := lines[i+window] - lines[i]
+		tolerance := 1e-9 * math.Max(1, math.Abs(bestScore))
+		if score > bestScore+tolerance || (score >= bestScore-tolerance && math.Abs(float64(i)-mid) < math.Abs(float64(best)-mid)) {
+			best, bestScore = i, score
+		}
+	}
+	off := int(math.Round(float64(best) * float64(full) / float64(n)))
+	off = maxInt(0, minInt(off, full-size))
+	if horizontal {
+		return image.Rect(b.Min.X+off, b.Min.Y, b.Min.X+off+size, b.Min.Y+ch)
+	}
+	return image.Rect(b.Min.X, b.Min.Y+off, b.Min.X+cw, b.Min.Y+off+size)
+}
+
+// SmartCrop crops to the rect of SmartCrop, without resizing.
+func (t *ImageTransform) SmartCrop(w, h int) *ImageTransform {
+	t.Im = imaging.Crop(t.Im, SmartCrop(t.Im, w, h))
+	return t
+}
+
+// saliency scores the pixels of im, row by row.
+func saliency(im *image.NRGBA) []float64 {
+	w, h := im.Bounds().Dx(), im.Bounds().Dy()
+	light := make([]float64, w*h)
+	scores := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := im.Pix[y*im.Stride+4*x:]
+			r, g, b := float64(p[0])/255, float64(p[1])/255, float64(p[2])/255
+			l := 0.2126*r + 0.7152*g + 0.0722*b
+			light[y*w+x] = l
+			scores[y*w+x] = skinWeight*skin(r, g, b, l) + saturationWeight*saturation(r, g, b)
+		}
+	}
+	at := func(x, y, dx, dy int) float64 {
+		if x+dx < 0 || x+dx >= w || y+dy < 0 || y+dy >= h {
+			return light[y*w+x]
+		}
+		return light[(y+dy)*w+x+dx]
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			edge := 4*light[y*w+x] - at(x, y, -1, 0) - at(x, y, 1, 0) - at(x, y, 0, -1) - at(x, y, 0, 1)
+			scores[y*w+x] += edgeWeight * math.Min(1, math.Abs(edge))
+		}
+	}
+	return scores
+}
+
+// skin scores how near the color is to skinColor, 0-1.
+func skin(r, g, b, l float64) float64 {
+	mag := math.Sqrt(r*r + g*g + b*b)
+	if mag == 0 || l < 0.2 {
+		return 0
+	}
+	dr, dg, db := r/mag-skinColor[0], g/mag-skinColor[1], b/mag-skinColor[2]
+	s := 1 - math.Sqrt(dr*dr+dg*dg+db*db)
+	if s < 0.8 {
+		return 0
+	}
+	return (s - 0.8) / 0.2
+}
+
+// saturation scores the hsl saturation above 0.4, 0-1. Colors near black or white do not count.
+func saturation(r, g, b float64) float64 {
+	max, min := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l := (max + min) / 2
+	if max == min || l < 0.05 || l > 0.9 {
+		return 0
+	}
+	s := (max - min) / (max + min)
+	if l > 0.5 {
+		s = (max - min) / (2 - max - min)
+	}
+	if s < 0.4 {
+		return 0
+	}
+	return (s - 0.4) / 0.6
+}
@@ -0,0 +1,37 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmartCrop(t *testing.T) {
+	gray := color.NRGBA{128, 128, 128, 255}
+	im := imaging.New(400, 200, gray)
+	assert.Equal(t, image.Rect(100, 0, 300, 200), SmartCrop(im, 100, 100))
+	assert.Equal(t, im.Bounds(), SmartCrop(im, 800, 400))
+
+	// a face colored blob on the right
+	face := imaging.New(60, 80, color.NRGBA{200, 145, 112, 255})
+	im = imaging.Paste(im, face, image.Pt(320, 60))
+	rect := SmartCrop(im, 100, 100)
+	assert.Equal(t, image.Pt(200, 200), rect.Size())
+	assert.True(t, image.Rect(320, 60, 380, 140).In(rect), rect)
+
+	// a saturated band at the top of a tall image
+	im = imaging.New(100, 400, gray)
+	im = imaging.Paste(im, imaging.New(100, 40, color.NRGBA{20, 60, 230, 255}), image.Pt(0, 10))
+	rect = SmartCrop(im, 1, 1)
+	assert.Equal(t, image.Pt(100, 100), rect.Size())
+	assert.True(t, image.Rect(0, 10, 100, 50).In(rect), rect)
+
+	it := &ImageTransform{Im: imaging.Paste(imaging.New(400, 200, gray), face, image.Pt(320, 60))}
+	p, _ := ParsePipeline("smart:50x50")
+	assert.Nil(t, it.Apply(p))
+	assert.Equal(t, image.Pt(50, 50), it.Im.Bounds().Size())
+	assert.Equal(t, image.Pt(200, 200), (&ImageTransform{Im: imaging.New(400, 200, gray)}).ResizeWith(300, 300, ResizeOptions{Mode: ResizeSmart, NoUpscale: true}).Im.Bounds().Size())
+}
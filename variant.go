@@ -0,0 +1,151 @@
+package httpfsclient
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/RocksonZeta/httpfsclient/util/imageutil"
+)
+
+// VariantSpec describes an image derived from an original: optional crop [x,y,w,h], then resize to Width x Height
+// as in ImageTransformParam. Every field is in the name, so variants resized differently get different paths.
+type VariantSpec struct {
+	Crop          []int
+	Width, Height int
+	Mode          string // imageutil.Resize*, "" stretches; width and height take a 0 Height or Width
+	Filter        string // imageutil.Filter*, "" is linear
+	Background    string // #rrggbb of ResizePad, "" is transparent
+	NoUpscale     bool
+}
+
+func (s VariantSpec) Validate() error {
+	if len(s.Crop) != 0 && len(s.Crop) != 4 {
+		return errors.New("VariantSpec crop param error. crop must be [x,y,w,h].")
+	}
+	if s.Width == 0 && s.Height == 0 {
+		if len(s.Crop) == 0 || "" != s.Mode || "" != s.Filter || "" != s.Background || s.NoUpscale {
+			return errors.New("VariantSpec size param error. size must be positive.")
+		}
+		return nil
+	}
+	switch s.Mode {
+	case imageutil.ResizeWidth:
+		if s.Width <= 0 || s.Height != 0 {
+			return errors.New("VariantSpec size param error. size must be Wx0.")
+		}
+	case imageutil.ResizeHeight:
+		if s.Width != 0 || s.Height <= 0 {
+			return errors.New("VariantSpec size param error. size must be 0xH.")
+		}
+	default:
+		if !imageutil.IsResizeMode(s.Mode) {
+			return errors.New("VariantSpec mode param error. unknown mode:" + s.Mode)
+		}
+		if s.Width <= 0 || s.Height <= 0 {
+			return errors.New("VariantSpec size param error. size must be positive.")
+		}
+	}
+	if !imageutil.IsFilter(s.Filter) {
+		return errors.New("VariantSpec filter param error. unknown filter:" + s.Filter)
+	}
+	if "" != s.Background {
+		if imageutil.ResizePad != s.Mode {
+			return errors.New("VariantSpec background param error. background is only for the pad mode.")
+		}
+		if _, err := imageutil.ParseColor(s.Background); err != nil {
+			return errors.New("VariantSpec background param error. background must be #rrggbb.")
+		}
+	}
+	return nil
+}
+
+// Name is the deterministic suffix of the variant file, eg. c10-10-100-100_60x60 , 60x60 , c0-0-50-50 ,
+// pad60x60_flanczos_bffffff_nu
+func (s VariantSpec) Name() string {
+	var parts []string
+	if len(s.Crop) == 4 {
+		cs := make([]string, 4)
+		for i, v := range s.Crop {
+			cs[i] = strconv.Itoa(v)
+		}
+		parts = append(parts, "c"+strings.Join(cs, "-"))
+	}
+	if s.Width > 0 || s.Height > 0 {
+		parts = append(parts, s.Mode+strconv.Itoa(s.Width)+"x"+strconv.Itoa(s.Height))
+	}
+	if "" != s.Filter {
+		parts = append(parts, "f"+s.Filter)
+	}
+	if "" != s.Background {
+		parts = append(parts, "b"+colorName(s.Background))
+	}
+	if s.NoUpscale {
+		parts = append(parts, "nu")
+	}
+	return strings.Join(parts, "_")
+}
+
+// colorName is the hex of the color, #fff and #FFFFFF are both ffffff.
+func colorName(c string) string {
+	v, err := imageutil.ParseColor(c)
+	if err != nil {
+		return strings.ToLower(strings.TrimPrefix(c, "#"))
+	}
+	n := color.NRGBAModel.Convert(v).(color.NRGBA)
+	if 0xff == n.A {
+		return fmt.Sprintf("%02x%02x%02x", n.R, n.G, n.B)
+	}
+	return fmt.Sprintf("%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+// Variant returns the link of the variant, stored next to the original as <name>_<spec>.<ext>
+// eg. static:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg -> static:s1/image/00/00/gysz2c6aqf/joexrtxyco_c10-10-100-100_60x60.jpg
+func (d HfLink) Variant(spec VariantSpec) (HfLink, error) {
+	if err := spec.Validate(); err != nil {
+		return "", err
+	}
+	p, err := d.HfPath()
+	if err != nil {
+		return "", err
+	}
+	clusterId, serverId, _ := d.Parts()
+	return p.WithName(p.BaseName()+"_"+spec.Name()+p.Ext()).HfLink(clusterId, serverId), nil
+}
+
+// EnsureVariant returns the variant link, it calls image/cropresize only if the variant does not exist yet.
+func (d HfLink) EnsureVariant(spec VariantSpec) (HfLink, error) {
+	return Methods{}.EnsureVariant(d, spec)
+}
+
+func (m Methods) EnsureVariant(hf HfLink, spec VariantSpec) (HfLink, error) {
+	variant, err := hf.Variant(spec)
+	if err != nil {
+		return "", err
+	}
+	info, err := variant.Stat()
+	if err != nil {
+		return "", err
+	}
+	if "" != info.Name {
+		return variant, nil
+	}
+	var sizes [][]int
+	if spec.Width > 0 || spec.Height > 0 {
+		sizes = [][]int{{spec.Width, spec.Height}}
+	}
+	clusterId, serverId, path := hf.Resolve().Parts()
+	param := ImageTransformParam{FilePath: path, Crop: spec.Crop, Resize: sizes, Mode: spec.Mode, Filter: spec.Filter,
+		Background: spec.Background, NoUpscale: spec.NoUpscale, Targets: []string{variant.Resolve().Path()}}
+	var resultPaths []string
+	err = m.Call(clusterId, serverId, "image", "cropresize", param, &resultPaths)
+	if err != nil {
+		return "", err
+	}
+	if len(resultPaths) != 1 || resultPaths[0] != variant.Resolve().Path() {
+		return "", errors.New("image/cropresize did not write the variant:" + strings.Join(resultPaths, ","))
+	}
+	return variant, nil
+}
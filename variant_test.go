@@ -0,0 +1,73 @@
+package httpfsclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/RocksonZeta/httpfsclient/util/imageutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnsureVariant(t *testing.T) {
+	const variantPath = "/image/00/00/gysz2c6aqf/joexrtxyco_60x60.jpg"
+	const fillPath = "/image/00/00/gysz2c6aqf/joexrtxyco_fill60x60_flanczos_nu.jpg"
+	exists, written := false, variantPath
+	calls := 0
+	var got httpfsclient.ImageTransformParam
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fs/stat" + variantPath:
+			if exists {
+				w.Write([]byte(`{"State":0,"Data":{"Name":"joexrtxyco_60x60.jpg","Size":10}}`))
+			} else {
+				w.Write([]byte(`{"State":0,"Data":{}}`))
+			}
+		case "/fs/stat" + fillPath:
+			w.Write([]byte(`{"State":0,"Data":{}}`))
+		case "/call/image/cropresize":
+			calls++
+			got = httpfsclient.ImageTransformParam{}
+			assert.Nil(t, json.Unmarshal([]byte(r.FormValue("args")), &got))
+			assert.Equal(t, "/image/00/00/gysz2c6aqf/joexrtxyco.jpg", got.FilePath)
+			assert.Equal(t, [][]int{{60, 60}}, got.Resize)
+			bs, _ := json.Marshal([]string{written})
+			w.Write([]byte(`{"State":0,"Data":` + string(bs) + `}`))
+		}
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "varc", ServerId: "s1", Local: ts.URL})
+	link := httpfsclient.HfLink("varc:s1/image/00/00/gysz2c6aqf/joexrtxyco.jpg")
+	spec := httpfsclient.VariantSpec{Width: 60, Height: 60}
+
+	// created
+	v, err := link.EnsureVariant(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.HfLink("varc:s1"+variantPath), v)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{variantPath}, got.Targets)
+
+	// the server wrote another path
+	written = "/image/00/00/gysz2c6aqf/other.jpg"
+	_, err = link.EnsureVariant(spec)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, calls)
+
+	// exists
+	exists = true
+	v, err = link.EnsureVariant(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.HfLink("varc:s1"+variantPath), v)
+	assert.Equal(t, 2, calls)
+
+	// the resize options are sent, the variant has its own path
+	written = fillPath
+	v, err = link.EnsureVariant(httpfsclient.VariantSpec{Width: 60, Height: 60, Mode: imageutil.ResizeFill, Filter: imageutil.FilterLanczos, NoUpscale: true})
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.HfLink("varc:s1"+fillPath), v)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, httpfsclient.ImageTransformParam{FilePath: "/image/00/00/gysz2c6aqf/joexrtxyco.jpg", Resize: [][]int{{60, 60}},
+		Mode: imageutil.ResizeFill, Filter: imageutil.FilterLanczos, NoUpscale: true, Targets: []string{fillPath}}, got)
+}
@@ -0,0 +1,124 @@
+package httpfsclient
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	VideoOutputDash = "dash"
+	VideoOutputHls  = "hls"
+)
+
+const (
+	VideoCodecH264 = "h264"
+	VideoCodecH265 = "h265"
+	VideoCodecVp9  = "vp9"
+	VideoCodecAv1  = "av1"
+)
+
+// Rendition is a step of the bitrate ladder.
+type Rendition struct {
+	Width, Height int    // Width 0 keeps the ratio
+	VideoBitrate  int    // kbps
+	AudioBitrate  int    `json:",omitempty"` // kbps, 0 drops the audio of this rendition
+	Codec         string // VideoCodec*
+}
+
+// DefaultLadder is used when VideoPackageParam.Renditions is empty.
+var DefaultLadder = []Rendition{
+	{Height: 360, VideoBitrate: 800, AudioBitrate: 96, Codec: VideoCodecH264},
+	{Height: 720, VideoBitrate: 2800, AudioBitrate: 128, Codec: VideoCodecH264},
+	{Height: 1080, VideoBitrate: 5000, AudioBitrate: 192, Codec: VideoCodecH264},
+}
+
+// VideoPackageParam is the param of video/Package. With both outputs, the manifests share one set of fmp4 segments.
+type VideoPackageParam struct {
+	File             string
+	ProgressRedisKey string
+	VideoId          int
+	Outputs          []string // VideoOutput*
+	Renditions       []Rendition
+}
+
+func (r Rendition) Validate() error {
+	if r.Width < 0 || r.Height <= 0 {
+		return errors.New("Rendition param error. height must be > 0, width >= 0.")
+	}
+	if r.VideoBitrate <= 0 || r.AudioBitrate < 0 {
+		return errors.New("Rendition param error. video bitrate must be > 0, audio bitrate >= 0.")
+	}
+	switch r.Codec {
+	case VideoCodecH264, VideoCodecH265, VideoCodecVp9, VideoCodecAv1:
+	default:
+		return errors.New("Rendition param error. unknown codec:" + strconv.Quote(r.Codec))
+	}
+	return nil
+}
+
+func (p VideoPackageParam) Validate() error {
+	if len(p.Outputs) == 0 {
+		return errors.New("VideoPackage param error. outputs must not be empty.")
+	}
+	for _, o := range p.Outputs {
+		if o != VideoOutputDash && o != VideoOutputHls {
+			return errors.New("VideoPackage param error. output must be dash or hls.")
+		}
+	}
+	for _, r := range p.Renditions {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VideoManifests are the manifest links of video/Package, a link is "" if its output was not asked for.
+type VideoManifests struct {
+	Dash HfLink // .mpd
+	Hls  HfLink // master .m3u8
+}
+
+// VideoPackageJob is the job of VideoPackage, the manifest links are in its result.
+type VideoPackageJob struct {
+	*Job
+}
+
+// Manifests returns the manifests of the finished job.
+func (j VideoPackageJob) Manifests() (VideoManifests, error) {
+	var r struct{ Dash, Hls string }
+	var m VideoManifests
+	err := j.Result(&r)
+	if err != nil {
+		return m, err
+	}
+	if "" != r.Dash {
+		if m.Dash, err = j.link(r.Dash); err != nil {
+			return m, err
+		}
+	}
+	if "" != r.Hls {
+		m.Hls, err = j.link(r.Hls)
+	}
+	return m, err
+}
+
+// VideoPackage transcodes the video to the renditions and writes the manifests of outputs, in the background.
+// progressKey as in VideoCompressDash.
+func (m Methods) VideoPackage(hf HfLink, param VideoPackageParam, progressKey string) (VideoPackageJob, error) {
+	if len(param.Renditions) == 0 {
+		param.Renditions = DefaultLadder
+	}
+	if err := param.Validate(); err != nil {
+		return VideoPackageJob{}, err
+	}
+	clusterId, serverId, path := hf.Resolve().Parts()
+	job := m.newJob(clusterId, serverId, "video", "Package", progressKey)
+	param.File, param.ProgressRedisKey = path, job.ProgressKey
+	job, err := m.callAsync(job, param)
+	return VideoPackageJob{job}, err
+}
+
+func (d HfLink) VideoPackage(param VideoPackageParam, progressKey string) (VideoPackageJob, error) {
+	return Methods{}.VideoPackage(d, param, progressKey)
+}
@@ -0,0 +1,38 @@
+package httpfsclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVideoPackage(t *testing.T) {
+	var got httpfsclient.VideoPackageParam
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/call/async/video/Package", r.URL.Path)
+		assert.Nil(t, json.Unmarshal([]byte(r.FormValue("args")), &got))
+		w.Write([]byte(`{"State":0}`))
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "pkgc", ServerId: "s1", Local: ts.URL})
+	link := httpfsclient.HfLink("pkgc:s1/video/00/00/gysz2c6aqf/joexrtxyco.mp4")
+
+	_, err := link.VideoPackage(httpfsclient.VideoPackageParam{VideoId: 1, Outputs: []string{httpfsclient.VideoOutputDash, httpfsclient.VideoOutputHls}}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, httpfsclient.DefaultLadder, got.Renditions)
+	assert.Equal(t, []string{"dash", "hls"}, got.Outputs)
+
+	for _, p := range []httpfsclient.VideoPackageParam{
+		{},
+		{Outputs: []string{"smooth"}},
+		{Outputs: []string{"hls"}, Renditions: []httpfsclient.Rendition{{Height: 720, VideoBitrate: 2800, Codec: "mpeg2"}}},
+		{Outputs: []string{"hls"}, Renditions: []httpfsclient.Rendition{{VideoBitrate: 2800, Codec: "h264"}}},
+	} {
+		_, err = link.VideoPackage(p, "")
+		assert.NotNil(t, err)
+	}
+}
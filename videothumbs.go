@@ -0,0 +1,186 @@
+package httpfsclient
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// VideoPosterParam is the param of video/poster.
+type VideoPosterParam struct {
+	File             string
+	ProgressRedisKey string
+	At               float64 // seconds into the video, negative lets the server pick a representative frame
+	Width            int     `json:",omitempty"` // 0 keeps the video width
+	Format           string  `json:",omitempty"` // ImageFormat*, default jpeg
+}
+
+// VideoSpriteParam is the param of video/sprite: a thumb every Interval seconds, Columns x Rows thumbs per sheet.
+type VideoSpriteParam struct {
+	File             string
+	ProgressRedisKey string
+	Interval         float64 // seconds
+	Width, Height    int     // thumb size, 0 keeps the ratio
+	Columns, Rows    int
+	Format           string `json:",omitempty"` // ImageFormat*, default jpeg
+}
+
+// VideoSprite is the result of video/sprite: the sheets in CollectionImage and the WebVTT index in CollectionTxt.
+// Each cue of the index is "<sheet path>#xywh=x,y,w,h", see ParseSpriteVtt.
+type VideoSprite struct {
+	Sheets []HfLink
+	Vtt    HfLink
+}
+
+// VideoPosterJob is the job of VideoPoster, the poster link is in its result.
+type VideoPosterJob struct {
+	*Job
+}
+
+// Poster returns the poster of the finished job.
+func (j VideoPosterJob) Poster() (HfLink, error) {
+	var r struct{ Poster string }
+	if err := j.Result(&r); err != nil {
+		return "", err
+	}
+	return j.link(r.Poster)
+}
+
+// VideoSpriteJob is the job of VideoSprite, the sheet and index links are in its result.
+type VideoSpriteJob struct {
+	*Job
+}
+
+// Sprite returns the sheets and the index of the finished job.
+func (j VideoSpriteJob) Sprite() (VideoSprite, error) {
+	var r struct {
+		Sheets []string
+		Vtt    string
+	}
+	var sprite VideoSprite
+	err := j.Result(&r)
+	if err != nil {
+		return sprite, err
+	}
+	if sprite.Sheets, err = toHfLinks(j.ClusterId, j.ServerId, r.Sheets); err != nil {
+		return sprite, err
+	}
+	sprite.Vtt, err = j.link(r.Vtt)
+	return sprite, err
+}
+
+// link turns a path returned by the job's server into a link.
+func (j *Job) link(path string) (HfLink, error) {
+	if "" == path {
+		return "", errors.New("job " + j.Id + " returned no file")
+	}
+	return ParseHfLink(j.ClusterId + ":" + j.ServerId + path)
+}
+
+// VideoPoster grabs a frame as an image, in the background. progressKey as in VideoCompressDash.
+func (m Methods) VideoPoster(hf HfLink, param VideoPosterParam, progressKey string) (VideoPosterJob, error) {
+	if param.Width < 0 {
+		return VideoPosterJob{}, errors.New("VideoPoster param error. width must be >= 0.")
+	}
+	clusterId, serverId, path := hf.Resolve().Parts()
+	job := m.newJob(clusterId, serverId, "video", "poster", progressKey)
+	param.File, param.ProgressRedisKey = path, job.ProgressKey
+	job, err := m.callAsync(job, param)
+	return VideoPosterJob{job}, err
+}
+
+// VideoSprite renders thumb sheets and their WebVTT index, in the background. progressKey as in VideoCompressDash.
+func (m Methods) VideoSprite(hf HfLink, param VideoSpriteParam, progressKey string) (VideoSpriteJob, error) {
+	if param.Interval <= 0 || param.Columns <= 0 || param.Rows <= 0 {
+		return VideoSpriteJob{}, errors.New("VideoSprite param error. interval, columns and rows must be > 0.")
+	}
+	if param.Width < 0 || param.Height < 0 || param.Width+param.Height == 0 {
+		return VideoSpriteJob{}, errors.New("VideoSprite param error. thumb size must be [w,h], 0 keeps the ratio.")
+	}
+	clusterId, serverId, path := hf.Resolve().Parts()
+	job := m.newJob(clusterId, serverId, "video", "sprite", progressKey)
+	param.File, param.ProgressRedisKey = path, job.ProgressKey
+	job, err := m.callAsync(job, param)
+	return VideoSpriteJob{job}, err
+}
+
+func (d HfLink) VideoPoster(param VideoPosterParam, progressKey string) (VideoPosterJob, error) {
+	return Methods{}.VideoPoster(d, param, progressKey)
+}
+func (d HfLink) VideoSprite(param VideoSpriteParam, progressKey string) (VideoSpriteJob, error) {
+	return Methods{}.VideoSprite(d, param, progressKey)
+}
+
+// SpriteCue is a cue of a sprite index: the thumb shown from Start to End seconds.
+type SpriteCue struct {
+	Start, End float64
+	Sheet      string // as written in the index, a path or an url
+	X, Y, W, H int
+}
+
+// ParseSpriteVtt parses the WebVTT index written by video/sprite.
+func ParseSpriteVtt(data []byte) ([]SpriteCue, error) {
+	var cues []SpriteCue
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() || !strings.HasPrefix(strings.TrimPrefix(scanner.Text(), "\ufeff"), "WEBVTT") {
+		return nil, errors.New("not a WebVTT file")
+	}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.Index(line, "-->")
+		if i < 0 {
+			continue
+		}
+		var cue SpriteCue
+		var err error
+		if cue.Start, err = parseVttTime(line[:i]); err != nil {
+			return nil, err
+		}
+		if cue.End, err = parseVttTime(line[i+3:]); err != nil {
+			return nil, err
+		}
+		if !scanner.Scan() {
+			return nil, errors.New("WebVTT cue without payload: " + line)
+		}
+		payload := strings.TrimSpace(scanner.Text())
+		j := strings.LastIndex(payload, "#xywh=")
+		if j < 0 {
+			return nil, errors.New("WebVTT cue payload without #xywh: " + payload)
+		}
+		cue.Sheet = payload[:j]
+		xywh := strings.Split(payload[j+6:], ",")
+		if len(xywh) != 4 {
+			return nil, errors.New("WebVTT cue payload bad #xywh: " + payload)
+		}
+		for k, p := range []*int{&cue.X, &cue.Y, &cue.W, &cue.H} {
+			if *p, err = strconv.Atoi(xywh[k]); err != nil {
+				return nil, errors.New("WebVTT cue payload bad #xywh: " + payload)
+			}
+		}
+		cues = append(cues, cue)
+	}
+	return cues, scanner.Err()
+}
+
+// parseVttTime parses "hh:mm:ss.ttt" or "mm:ss.ttt", cue settings after the time are ignored.
+func parseVttTime(s string) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, errors.New("empty WebVTT time")
+	}
+	parts := strings.Split(fields[0], ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, errors.New("bad WebVTT time: " + fields[0])
+	}
+	var t float64
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, errors.New("bad WebVTT time: " + fields[0])
+		}
+		t = t*60 + v
+	}
+	return t, nil
+}
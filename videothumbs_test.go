@@ -0,0 +1,44 @@
+package httpfsclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVideoSprite(t *testing.T) {
+	var got httpfsclient.VideoSpriteParam
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/call/async/video/sprite", r.URL.Path)
+		assert.Nil(t, json.Unmarshal([]byte(r.FormValue("args")), &got))
+		assert.Equal(t, got.ProgressRedisKey, r.FormValue("progress"))
+		w.Write([]byte(`{"State":0}`))
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "spritec", ServerId: "s1", Local: ts.URL})
+	link := httpfsclient.HfLink("spritec:s1/video/00/00/gysz2c6aqf/joexrtxyco.mp4")
+
+	job, err := link.VideoSprite(httpfsclient.VideoSpriteParam{Interval: 5, Width: 160, Columns: 10, Rows: 10}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "/video/00/00/gysz2c6aqf/joexrtxyco.mp4", got.File)
+	assert.Equal(t, job.ProgressKey, got.ProgressRedisKey)
+	_, err = link.VideoSprite(httpfsclient.VideoSpriteParam{Interval: 5, Columns: 10, Rows: 10}, "")
+	assert.NotNil(t, err)
+}
+
+func TestParseSpriteVtt(t *testing.T) {
+	cues, err := httpfsclient.ParseSpriteVtt([]byte("WEBVTT\n\n1\n00:00:00.000 --> 00:00:05.000\n/image/00/01/abc/s0.jpg#xywh=0,0,160,90\n\n00:05.000 --> 00:10.500 align:start\n/image/00/01/abc/s0.jpg#xywh=160,0,160,90\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []httpfsclient.SpriteCue{
+		{Start: 0, End: 5, Sheet: "/image/00/01/abc/s0.jpg", X: 0, Y: 0, W: 160, H: 90},
+		{Start: 5, End: 10.5, Sheet: "/image/00/01/abc/s0.jpg", X: 160, Y: 0, W: 160, H: 90},
+	}, cues)
+	_, err = httpfsclient.ParseSpriteVtt([]byte("00:00.000 --> 00:05.000\na.jpg#xywh=0,0,1,1\n"))
+	assert.NotNil(t, err)
+	_, err = httpfsclient.ParseSpriteVtt([]byte("WEBVTT\n\n00:00.000 --> 00:05.000\na.jpg\n"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,234 @@
+package httpfsclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Completion webhooks. When an async call was made with Methods.CallbackUrl, the server posts a WebhookEvent as json
+// to the url once the job finishes, with the headers:
+//
+//	X-Httpfs-Delivery  : id of the delivery, the same on every retry
+//	X-Httpfs-Timestamp : unix seconds of the attempt
+//	X-Httpfs-Key-Id    : id of the cluster sign key, see SetSignKeys
+//	X-Httpfs-Signature : SignWebhook(key, timestamp, delivery, body)
+//
+// The server retries until it gets a 2xx response.
+const (
+	WebhookHeaderDelivery  = "X-Httpfs-Delivery"
+	WebhookHeaderTimestamp = "X-Httpfs-Timestamp"
+	WebhookHeaderKeyId     = "X-Httpfs-Key-Id"
+	WebhookHeaderSignature = "X-Httpfs-Signature"
+)
+
+// WebhookTolerance is the most a webhook timestamp may differ from now.
+var WebhookTolerance = 5 * time.Minute
+
+// WebhookDedupTtl is how long delivery ids are remembered.
+var WebhookDedupTtl = 24 * time.Hour
+
+// WebhookInFlightTtl is how long a delivery being dispatched refuses its retries, in case the process dies while dispatching.
+var WebhookInFlightTtl = 10 * time.Minute
+
+// states of a seen delivery
+const (
+	deliveryInFlight = "inflight"
+	deliveryDone     = "done"
+)
+
+// WebhookDedupKeyPrefix prefixes the redis keys of seen deliveries, followed by clusterId + ":" + delivery id.
+const WebhookDedupKeyPrefix = "httpfs/webhook/"
+
+// WebhookEvent is the body of a completion webhook.
+type WebhookEvent struct {
+	JobProgress
+	ClusterId, ServerId string
+	Module, Method      string
+}
+
+type WebhookFunc func(e WebhookEvent) error
+
+// SignWebhook = base64url(hmac-sha256(secret, timestamp + "." + delivery + "." + body))
+// The delivery id is signed so a captured webhook can not be replayed as a new delivery.
+func SignWebhook(key SignKey, timestamp int64, delivery string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key.Secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + delivery + "."))
+	mac.Write(body)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookHandler receives the completion webhooks of a cluster's servers, verifies them with the cluster's sign keys,
+// answers the retries of a delivery being dispatched with 409, drops those of a dispatched one, and dispatches the events to the handlers of the job id, then of module/method.
+// Seen deliveries are kept in redis after InitClusters, else in memory.
+type WebhookHandler struct {
+	ClusterId string
+
+	mu      sync.Mutex
+	jobs    map[string]WebhookFunc
+	methods map[string]WebhookFunc
+	seen    map[string]seenDelivery
+}
+
+type seenDelivery struct {
+	state   string
+	expires time.Time
+}
+
+func NewWebhookHandler(clusterId string) *WebhookHandler {
+	return &WebhookHandler{ClusterId: clusterId, jobs: map[string]WebhookFunc{}, methods: map[string]WebhookFunc{}, seen: map[string]seenDelivery{}}
+}
+
+// OnJob handles the completion of one job, the handler is dropped once it succeeds.
+func (h *WebhookHandler) OnJob(jobId string, fn WebhookFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.jobs[jobId] = fn
+}
+
+// OnMethod handles the completions of all jobs of module/method without a job handler.
+func (h *WebhookHandler) OnMethod(module, method string, fn WebhookFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.methods[module+"/"+method] = fn
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.verify(r, body) {
+		http.Error(w, "bad webhook signature", http.StatusUnauthorized)
+		return
+	}
+	var e WebhookEvent
+	if err = json.Unmarshal(body, &e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	delivery := r.Header.Get(WebhookHeaderDelivery)
+	if "" == delivery {
+		delivery = e.JobId
+	}
+	state, err := h.claim(delivery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch state {
+	case deliveryDone:
+		w.WriteHeader(http.StatusOK)
+		return
+	case deliveryInFlight: // the server retries it later, the first attempt may still fail
+		http.Error(w, "delivery in flight", http.StatusConflict)
+		return
+	}
+	if err = h.dispatch(e); err != nil {
+		h.finish(delivery, false) // let the server retry
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.finish(delivery, true)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *WebhookHandler) verify(r *http.Request, body []byte) bool {
+	ts, err := strconv.ParseInt(r.Header.Get(WebhookHeaderTimestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > WebhookTolerance || d < -WebhookTolerance {
+		return false
+	}
+	key, ok := findSignKey(GetSignKeys(h.ClusterId), r.Header.Get(WebhookHeaderKeyId))
+	if !ok {
+		return false
+	}
+	return hmac.Equal([]byte(r.Header.Get(WebhookHeaderSignature)), []byte(SignWebhook(key, ts, r.Header.Get(WebhookHeaderDelivery), body)))
+}
+
+func (h *WebhookHandler) dispatch(e WebhookEvent) error {
+	h.mu.Lock()
+	fn, byJob := h.jobs[e.JobId]
+	if !byJob {
+		fn = h.methods[e.Module+"/"+e.Method]
+	}
+	h.mu.Unlock()
+	if nil == fn {
+		return nil
+	}
+	if err := fn(e); err != nil {
+		return err
+	}
+	if byJob {
+		h.mu.Lock()
+		delete(h.jobs, e.JobId)
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+func (h *WebhookHandler) dedupKey(delivery string) string {
+	return WebhookDedupKeyPrefix + h.ClusterId + ":" + delivery
+}
+
+// claim marks the delivery in flight and returns "", or returns the state of a seen delivery.
+func (h *WebhookHandler) claim(delivery string) (string, error) {
+	if nil != redisFactory {
+		redis := redisFactory.Get()
+		defer redis.Close()
+		key := h.dedupKey(delivery)
+		claimed, err := redis.SetNX(key, deliveryInFlight, int(WebhookInFlightTtl/time.Second))
+		if err != nil || claimed {
+			return "", err
+		}
+		state, err := redis.GetBytes(key)
+		return string(state), err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	for k, d := range h.seen {
+		if now.After(d.expires) {
+			delete(h.seen, k)
+		}
+	}
+	if d, ok := h.seen[delivery]; ok {
+		return d.state, nil
+	}
+	h.seen[delivery] = seenDelivery{state: deliveryInFlight, expires: now.Add(WebhookInFlightTtl)}
+	return "", nil
+}
+
+// finish marks a claimed delivery done, or forgets it if the dispatch failed.
+func (h *WebhookHandler) finish(delivery string, done bool) {
+	if nil != redisFactory {
+		redis := redisFactory.Get()
+		defer redis.Close()
+		if done {
+			redis.Set(h.dedupKey(delivery), deliveryDone, int(WebhookDedupTtl/time.Second))
+		} else {
+			redis.Delete(h.dedupKey(delivery))
+		}
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if done {
+		h.seen[delivery] = seenDelivery{state: deliveryDone, expires: time.Now().Add(WebhookDedupTtl)}
+	} else {
+		delete(h.seen, delivery)
+	}
+}
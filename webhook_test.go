@@ -0,0 +1,106 @@
+package httpfsclient_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func postWebhook(h http.Handler, key httpfsclient.SignKey, delivery string, ts time.Time, e httpfsclient.WebhookEvent) int {
+	return replayWebhook(h, key, delivery, delivery, ts, e)
+}
+
+// replayWebhook posts a webhook signed for the delivery signed, as delivery.
+func replayWebhook(h http.Handler, key httpfsclient.SignKey, signed, delivery string, ts time.Time, e httpfsclient.WebhookEvent) int {
+	body, _ := json.Marshal(e)
+	r := httptest.NewRequest("POST", "/hooks/httpfs", bytes.NewReader(body))
+	r.Header.Set(httpfsclient.WebhookHeaderDelivery, delivery)
+	r.Header.Set(httpfsclient.WebhookHeaderTimestamp, strconv.FormatInt(ts.Unix(), 10))
+	r.Header.Set(httpfsclient.WebhookHeaderKeyId, key.Id)
+	r.Header.Set(httpfsclient.WebhookHeaderSignature, httpfsclient.SignWebhook(key, ts.Unix(), signed, body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestWebhookHandler(t *testing.T) {
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(nil))
+	key := httpfsclient.SignKey{Id: "k1", Secret: "hook-secret"}
+	httpfsclient.SetSignKeys("hookc", key)
+	h := httpfsclient.NewWebhookHandler("hookc")
+	var byJob, byMethod []string
+	fail := true
+	h.OnJob("j1", func(e httpfsclient.WebhookEvent) error {
+		if fail {
+			fail = false
+			return errors.New("db down")
+		}
+		byJob = append(byJob, e.JobId)
+		return nil
+	})
+	h.OnMethod("video", "Mp4", func(e httpfsclient.WebhookEvent) error {
+		byMethod = append(byMethod, e.JobId)
+		return nil
+	})
+	now := time.Now()
+	e1 := httpfsclient.WebhookEvent{JobProgress: httpfsclient.JobProgress{JobId: "j1", State: httpfsclient.JobStateDone}, Module: "video", Method: "Mp4"}
+	e2 := httpfsclient.WebhookEvent{JobProgress: httpfsclient.JobProgress{JobId: "j2", State: httpfsclient.JobStateDone}, Module: "video", Method: "Mp4"}
+
+	assert.Equal(t, 500, postWebhook(h, key, "d1", now, e1)) // handler failed, retry is accepted
+	assert.Equal(t, 200, postWebhook(h, key, "d1", now, e1))
+	assert.Equal(t, 200, postWebhook(h, key, "d1", now, e1)) // duplicate
+	assert.Equal(t, 200, postWebhook(h, key, "d2", now, e2))
+	assert.Equal(t, []string{"j1"}, byJob)
+	assert.Equal(t, []string{"j2"}, byMethod)
+
+	assert.Equal(t, 401, postWebhook(h, httpfsclient.SignKey{Id: "k1", Secret: "wrong"}, "d3", now, e2))
+	assert.Equal(t, 401, postWebhook(h, key, "d3", now.Add(-time.Hour), e2))
+	assert.Equal(t, 401, replayWebhook(h, key, "d2", "d3", now, e2)) // a seen delivery sent again under a new id
+	assert.Equal(t, []string{"j2"}, byMethod)
+}
+
+func TestWebhookInFlight(t *testing.T) {
+	key := httpfsclient.SignKey{Id: "k1", Secret: "hook-secret"}
+	httpfsclient.SetSignKeys("flightc", key)
+	defer httpfsclient.SetRedisFactory(httpfsclient.SetRedisFactory(nil))
+	for _, redis := range []*memRedis{nil, newMemRedis()} {
+		if nil == redis {
+			httpfsclient.SetRedisFactory(nil)
+		} else {
+			httpfsclient.SetRedisFactory(redis.factory())
+		}
+		h := httpfsclient.NewWebhookHandler("flightc")
+		started, release := make(chan bool), make(chan error)
+		calls := 0
+		h.OnMethod("video", "Mp4", func(e httpfsclient.WebhookEvent) error {
+			calls++
+			started <- true
+			return <-release
+		})
+		e := httpfsclient.WebhookEvent{JobProgress: httpfsclient.JobProgress{JobId: "j1", State: httpfsclient.JobStateDone}, Module: "video", Method: "Mp4"}
+		now := time.Now()
+
+		first := make(chan int)
+		go func() { first <- postWebhook(h, key, "d1", now, e) }()
+		<-started
+		// a retry while the first attempt is running is refused, the first attempt then fails
+		assert.Equal(t, http.StatusConflict, postWebhook(h, key, "d1", now, e))
+		release <- errors.New("db down")
+		assert.Equal(t, http.StatusInternalServerError, <-first)
+
+		go func() { first <- postWebhook(h, key, "d1", now, e) }()
+		<-started
+		release <- nil
+		assert.Equal(t, http.StatusOK, <-first)
+		assert.Equal(t, http.StatusOK, postWebhook(h, key, "d1", now, e)) // done, not dispatched again
+		assert.Equal(t, 2, calls)
+	}
+}
@@ -0,0 +1,260 @@
+package httpfsclient
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient/util/httputil"
+)
+
+type ZipEntry struct {
+	Name           string
+	Size           int64
+	CompressedSize int64
+	Modified       time.Time
+}
+
+// ZipEntryParam is the param of zip/read.
+type ZipEntryParam struct {
+	FilePath string
+	Name     string
+}
+
+// ZipExtractParam is the param of zip/extract, all the files are extracted if Names is empty.
+type ZipExtractParam struct {
+	FilePath string
+	Names    []string `json:",omitempty"`
+}
+
+// The zip methods fall back to reading the archive from /fs/read with range requests when the server has no zip module,
+// only the central directory and the entries used are downloaded.
+
+// ZipList lists the entries of the archive.
+func (m Methods) ZipList(hf HfLink) ([]ZipEntry, error) {
+	clusterId, serverId, p := hf.Resolve().Parts()
+	var entries []ZipEntry
+	err := m.Call(clusterId, serverId, "zip", "list", FileParam{FilePath: p}, &entries)
+	if !IsMethodNotFound(err) {
+		return entries, err
+	}
+	r, err := openRemoteZip(hf)
+	if err != nil {
+		return nil, err
+	}
+	entries = make([]ZipEntry, len(r.File))
+	for i, f := range r.File {
+		entries[i] = ZipEntry{Name: f.Name, Size: int64(f.UncompressedSize64), CompressedSize: int64(f.CompressedSize64), Modified: f.Modified}
+	}
+	return entries, nil
+}
+
+// ZipRead streams the content of an entry, the caller closes it.
+// The server answers zip/read with the raw content instead of a JsonResult.
+func (m Methods) ZipRead(hf HfLink, name string) (io.ReadCloser, error) {
+	clusterId, serverId, p := hf.Resolve().Parts()
+	server := GetServer(clusterId, serverId)
+	if "" == server.ClusterId {
+		return nil, errors.New("no such server:" + string(hf))
+	}
+	args, err := json.Marshal(ZipEntryParam{FilePath: p, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	header := map[string]string{httputil.HeaderIdempotencyKey: idempotencyKey(m.callKey("zip", "read"))}
+	resp, err := httputil.HttpPostFormStream(server.Local+"/call/zip/read", map[string]string{"args": string(args)}, header, 3)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+	bs, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err = (&CallError{Status: resp.StatusCode, Body: string(bs)}); !IsMethodNotFound(err) {
+		return nil, err
+	}
+	r, err := openRemoteZip(hf)
+	if err != nil {
+		return nil, err
+	}
+	f, err := zipFile(r, name)
+	if err != nil {
+		return nil, err
+	}
+	return f.Open()
+}
+
+// ZipExtract extracts the files of the archive to the server of the archive, each to the collection of its extension.
+// Without a zip module on the server, the files are downloaded and written back.
+func (m Methods) ZipExtract(hf HfLink, names ...string) ([]HfLink, error) {
+	clusterId, serverId, p := hf.Resolve().Parts()
+	var resultPaths []string
+	err := m.Call(clusterId, serverId, "zip", "extract", ZipExtractParam{FilePath: p, Names: names}, &resultPaths)
+	if err == nil {
+		return toHfLinks(clusterId, serverId, resultPaths)
+	}
+	if !IsMethodNotFound(err) {
+		return nil, err
+	}
+	r, err := openRemoteZip(hf)
+	if err != nil {
+		return nil, err
+	}
+	var files []*zip.File
+	if len(names) == 0 {
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() {
+				files = append(files, f)
+			}
+		}
+	}
+	for _, name := range names {
+		f, err := zipFile(r, name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	server := GetServer(clusterId, serverId)
+	links := make([]HfLink, len(files))
+	for i, f := range files {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		// buffered, so that WriteServerKey can retry a failed write
+		bs, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		key := ""
+		if "" != m.IdempotencyKey {
+			key = m.IdempotencyKey + "/" + f.Name
+		}
+		links[i], err = WriteServerKey(server, bytes.NewReader(bs), path.Base(f.Name), CollectionOf(f.Name), key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+func (d HfLink) ZipList() ([]ZipEntry, error) {
+	return Methods{}.ZipList(d)
+}
+func (d HfLink) ZipRead(name string) (io.ReadCloser, error) {
+	return Methods{}.ZipRead(d, name)
+}
+func (d HfLink) ZipExtract(names ...string) ([]HfLink, error) {
+	return Methods{}.ZipExtract(d, names...)
+}
+
+var collectionExts = map[string]string{
+	".jpg": CollectionImage, ".jpeg": CollectionImage, ".png": CollectionImage, ".gif": CollectionImage, ".webp": CollectionImage, ".bmp": CollectionImage,
+	".mp4": CollectionVideo, ".webm": CollectionVideo, ".mov": CollectionVideo, ".mkv": CollectionVideo, ".avi": CollectionVideo,
+	".epub": CollectionEpub,
+	".txt":  CollectionTxt, ".md": CollectionTxt, ".vtt": CollectionTxt, ".csv": CollectionTxt, ".json": CollectionTxt,
+	".pdf": CollectionPdf,
+	".doc": CollectionOffice, ".docx": CollectionOffice, ".xls": CollectionOffice, ".xlsx": CollectionOffice, ".ppt": CollectionOffice, ".pptx": CollectionOffice,
+	".zip": CollectionZip,
+}
+
+// CollectionOf returns the collection of a file name by its extension, CollectionBin if unknown.
+func CollectionOf(name string) string {
+	if c, ok := collectionExts[strings.ToLower(path.Ext(name))]; ok {
+		return c
+	}
+	return CollectionBin
+}
+
+func zipFile(r *zip.Reader, name string) (*zip.File, error) {
+	for _, f := range r.File {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return nil, errors.New("no such zip entry:" + name)
+}
+
+// openRemoteZip opens the archive with range requests to /fs/read.
+func openRemoteZip(hf HfLink) (*zip.Reader, error) {
+	clusterId, serverId, p := hf.Resolve().Parts()
+	server := GetServer(clusterId, serverId)
+	if "" == server.ClusterId {
+		return nil, errors.New("no such server:" + string(hf))
+	}
+	info, err := (&Client{Server: server.Local}).Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if "" == info.Name {
+		return nil, errors.New("no such file:" + string(hf))
+	}
+	return zip.NewReader(&rangeReaderAt{url: server.Local + "/fs/read" + p, size: info.Size}, info.Size)
+}
+
+// ZipReadAhead is the least size of the range requests of the archives read from /fs/read,
+// archive/zip reads in chunks of a few KB.
+var ZipReadAhead int64 = 1 << 20
+
+// rangeReaderAt reads an url of size bytes with range requests, the last response is kept for the next reads.
+type rangeReaderAt struct {
+	url  string
+	size int64
+	mu   sync.Mutex
+	off  int64 // of buf
+	buf  []byte
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(p) && off < r.size {
+		if off < r.off || off >= r.off+int64(len(r.buf)) {
+			if err := r.fill(off, int64(len(p)-n)); err != nil {
+				return n, err
+			}
+		}
+		m := copy(p[n:], r.buf[off-r.off:])
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fill reads at least want bytes at off, ZipReadAhead if more.
+func (r *rangeReaderAt) fill(off, want int64) error {
+	if want < ZipReadAhead {
+		want = ZipReadAhead
+	}
+	if off+want > r.size {
+		want = r.size - off
+	}
+	status, bs, err := httputil.HttpGetRange(r.url, off, want, 3)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusPartialContent {
+		return errors.New("range request not supported, status " + strconv.Itoa(status) + ": " + r.url)
+	}
+	if len(bs) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	r.off, r.buf = off, bs
+	return nil
+}
@@ -0,0 +1,148 @@
+package httpfsclient_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RocksonZeta/httpfsclient"
+	"github.com/RocksonZeta/httpfsclient/util/httputil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipFallback(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"a.txt": "hello", "img/b.png": strings.Repeat("png", 100)} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	archive := buf.Bytes()
+	var written []string
+	ranges, writes := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/fs/stat/zip/00/00/gysz2c6aqf/a.zip":
+			bs, _ := json.Marshal(map[string]interface{}{"State": 0, "Data": httpfsclient.FileInfo{Name: "a.zip", Size: int64(len(archive))}})
+			w.Write(bs)
+		case r.URL.Path == "/fs/read/zip/00/00/gysz2c6aqf/a.zip":
+			assert.NotEmpty(t, r.Header.Get("Range"))
+			ranges++
+			http.ServeContent(w, r, "a.zip", time.Time{}, bytes.NewReader(archive))
+		case strings.HasPrefix(r.URL.Path, "/fs/write/"):
+			_, h, err := r.FormFile("file")
+			assert.Nil(t, err)
+			if writes++; writes == 1 { // the first write fails, the entry is written again
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			written = append(written, r.URL.Path+"/"+h.Filename)
+			w.Write([]byte(`{"State":0,"Data":"/` + strings.TrimPrefix(r.URL.Path, "/fs/write/") + `/00/00/abcdefghij/` + h.Filename + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "zipc", ServerId: "s1", Local: ts.URL})
+	link := httpfsclient.HfLink("zipc:s1/zip/00/00/gysz2c6aqf/a.zip")
+
+	entries, err := link.ZipList()
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, 1, ranges) // the whole small archive in one request
+	for _, e := range entries {
+		if e.Name == "a.txt" {
+			assert.Equal(t, int64(5), e.Size)
+		}
+	}
+	rc, err := link.ZipRead("img/b.png")
+	assert.Nil(t, err)
+	bs, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, strings.Repeat("png", 100), string(bs))
+	_, err = link.ZipRead("c.txt")
+	assert.NotNil(t, err)
+
+	links, err := link.ZipExtract("img/b.png")
+	assert.Nil(t, err)
+	assert.Equal(t, []httpfsclient.HfLink{"zipc:s1/image/00/00/abcdefghij/b.png"}, links)
+	assert.Equal(t, []string{"/fs/write/image/b.png"}, written)
+	assert.Equal(t, 2, writes)
+}
+
+func TestZipReadAhead(t *testing.T) {
+	content := make([]byte, 300<<10)
+	rand.New(rand.NewSource(1)).Read(content)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("a.bin")
+	w.Write(content)
+	zw.Close()
+	archive := buf.Bytes()
+	ranges := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fs/stat/zip/00/00/gysz2c6aqf/b.zip":
+			bs, _ := json.Marshal(map[string]interface{}{"State": 0, "Data": httpfsclient.FileInfo{Name: "b.zip", Size: int64(len(archive))}})
+			w.Write(bs)
+		case "/fs/read/zip/00/00/gysz2c6aqf/b.zip":
+			ranges++
+			http.ServeContent(w, r, "b.zip", time.Time{}, bytes.NewReader(archive))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "zipc", ServerId: "s3", Local: ts.URL})
+	readAhead := httpfsclient.ZipReadAhead
+	httpfsclient.ZipReadAhead = 64 << 10
+	defer func() { httpfsclient.ZipReadAhead = readAhead }()
+
+	rc, err := httpfsclient.HfLink("zipc:s3/zip/00/00/gysz2c6aqf/b.zip").ZipRead("a.bin")
+	assert.Nil(t, err)
+	bs, err := ioutil.ReadAll(rc)
+	rc.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, content, bs)
+	// the directory, then the entry in windows of 64KB
+	assert.True(t, ranges <= 2+len(archive)/(64<<10), ranges)
+}
+
+func TestZipServer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/call/zip/read":
+			assert.Equal(t, `{"FilePath":"/zip/00/00/gysz2c6aqf/a.zip","Name":"a.txt"}`, r.FormValue("args"))
+			assert.Equal(t, 32, len(r.Header.Get(httputil.HeaderIdempotencyKey)))
+			w.Write([]byte("hello"))
+		case "/call/zip/extract":
+			w.Write([]byte(`{"State":0,"Data":["/txt/00/00/abcdefghij/a.txt"]}`))
+		default:
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+	httpfsclient.GetClusters().AddServer(httpfsclient.Server{ClusterId: "zipc", ServerId: "s2", Local: ts.URL})
+	link := httpfsclient.HfLink("zipc:s2/zip/00/00/gysz2c6aqf/a.zip")
+
+	rc, err := link.ZipRead("a.txt")
+	assert.Nil(t, err)
+	bs, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "hello", string(bs))
+	links, err := link.ZipExtract()
+	assert.Nil(t, err)
+	assert.Equal(t, []httpfsclient.HfLink{"zipc:s2/txt/00/00/abcdefghij/a.txt"}, links)
+	_, err = link.ZipList()
+	assert.False(t, httpfsclient.IsMethodNotFound(err))
+	assert.NotNil(t, err)
+}